@@ -1,15 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"jiramo/internal/analytics"
 	"jiramo/internal/config"
 	"jiramo/internal/db"
+	"jiramo/internal/geoip"
 	"jiramo/internal/handler"
+	"jiramo/internal/imports"
+	"jiramo/internal/ingest"
+	"jiramo/internal/live"
 	"jiramo/internal/middleware"
 	"jiramo/internal/models"
+	"jiramo/internal/notify"
+	"jiramo/internal/reports"
 	"jiramo/internal/routes"
+	"jiramo/internal/utils"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -38,30 +54,120 @@ func main() {
 		log.Println("Application state: NO DB - setup required")
 	}
 
+	if path := config.Global.BOT_PATTERNS_FILE; path != "" {
+		if err := utils.LoadBotPatterns(path); err != nil {
+			log.Fatalf("Invalid BOT_PATTERNS_FILE: %v", err)
+		}
+	}
+
 	setupHandler := handler.NewSetupHandler(DB)
 	authHandlers := handler.NewAuthHandler(DB)
 	projectHandlers := handler.NewProjectHandler(DB)
 	userHandler := handler.NewUserHandler(DB)
 	webHandler := handler.NewWebHandler()
 	profileHandlers := handler.NewProfileHandler(DB)
-	analyticsHandlers := handler.NewAnalyticsHandler(DB)
+	ingestQueue := ingest.NewQueue(DB, 10000, 4, 500, time.Second)
+	liveHub := live.NewHub(5 * time.Second)
+	liveHub.Start()
+	analyticsHandlers := handler.NewAnalyticsHandler(DB, ingestQueue, liveHub)
+	if path := config.Global.GEOIP_DB_PATH; path != "" {
+		geo, err := geoip.Open(path)
+		if err != nil {
+			log.Fatalf("Invalid GEOIP_DB_PATH: %v", err)
+		}
+		analyticsHandlers.Geo = geo
+	}
 	apiKeyHandler := handler.NewAPIKeyHandler(DB)
+	goalHandler := handler.NewGoalHandler(DB)
+
+	var mailer *notify.SMTP
+	if config.Global.SMTP_HOST != "" {
+		mailer = &notify.SMTP{
+			Host:     config.Global.SMTP_HOST,
+			Port:     config.Global.SMTP_PORT,
+			Username: config.Global.SMTP_USERNAME,
+			Password: config.Global.SMTP_PASSWORD,
+			From:     config.Global.SMTP_FROM,
+		}
+	}
+
+	notifiers := notify.NewRegistry()
+	notifiers.Register("webhook", notify.NewWebhook())
+	notifiers.Register("in_app", notify.NewStore(func() *gorm.DB { return analyticsHandlers.DB }))
+	if mailer != nil {
+		notifiers.Register("email", mailer)
+	}
+	alertHandler := handler.NewAlertHandler(DB, notifiers)
+	reportHandler := handler.NewReportHandler(DB, mailer)
+	importHandler := handler.NewImportHandler(DB, config.Global.IMPORT_DIR)
 
 	setupHandler.SetHandlerRegistry(&handler.HandlerRegistry{
-		Auth:    authHandlers,
-		Project: projectHandlers,
-		User:    userHandler,
-		Profile: profileHandlers,
+		Auth:      authHandlers,
+		Project:   projectHandlers,
+		User:      userHandler,
+		Profile:   profileHandlers,
+		Analytics: analyticsHandlers,
+		APIKey:    apiKeyHandler,
+		Goal:      goalHandler,
+		Alert:     alertHandler,
+		Report:    reportHandler,
+		Import:    importHandler,
 	})
 
+	rollups := analytics.NewRollups(func() *gorm.DB { return analyticsHandlers.DB }, 5*time.Minute)
+	rollups.Start()
+
+	retentionDays, err := strconv.Atoi(config.Global.ANALYTICS_RETENTION_DAYS)
+	if err != nil {
+		log.Fatalf("Invalid ANALYTICS_RETENTION_DAYS: %v", err)
+	}
+	pruner := analytics.NewPruner(func() *gorm.DB { return analyticsHandlers.DB }, retentionDays, 24*time.Hour)
+	pruner.Start()
+
+	alerts := analytics.NewAlerts(func() *gorm.DB { return analyticsHandlers.DB }, notifiers, 5*time.Minute)
+	alerts.Start()
+
+	reportScheduler := reports.NewScheduler(func() *gorm.DB { return analyticsHandlers.DB }, mailer, 5*time.Minute)
+	reportScheduler.Start()
+
+	importRunner := imports.NewRunner(func() *gorm.DB { return analyticsHandlers.DB }, 15*time.Second)
+	importRunner.Start()
+
 	router := mux.NewRouter()
 
 	router.Use(middleware.Recover)
 	router.Use(middleware.Logging)
 	router.Use(middleware.AppState)
 
-	routes.SetupRoutes(router, authHandlers, projectHandlers, webHandler, userHandler, setupHandler, profileHandlers, analyticsHandlers, apiKeyHandler, DB)
+	routes.SetupRoutes(router, authHandlers, projectHandlers, webHandler, userHandler, setupHandler, profileHandlers, analyticsHandlers, apiKeyHandler, goalHandler, alertHandler, reportHandler, importHandler)
+
+	server := &http.Server{Addr: ":8080", Handler: router}
+	server.RegisterOnShutdown(liveHub.Stop)
 
-	fmt.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	go func() {
+		fmt.Println("Server started on :8080")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	if err := ingestQueue.Close(ctx); err != nil {
+		log.Printf("Error draining ingest queue: %v", err)
+	}
+	rollups.Stop()
+	pruner.Stop()
+	alerts.Stop()
+	reportScheduler.Stop()
+	importRunner.Stop()
 }
@@ -0,0 +1,240 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"jiramo/internal/models"
+	"jiramo/internal/notify"
+
+	"gorm.io/gorm"
+)
+
+const alertSendTimeout = 30 * time.Second
+
+// Alerts periodically evaluates the enabled alert rules and sends a
+// notification for every rule whose condition holds, at most once per
+// cooldown.
+type Alerts struct {
+	db        func() *gorm.DB
+	notifiers *notify.Registry
+	interval  time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func NewAlerts(db func() *gorm.DB, notifiers *notify.Registry, interval time.Duration) *Alerts {
+	return &Alerts{
+		db:        db,
+		notifiers: notifiers,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (a *Alerts) Start() {
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := a.Run(); err != nil {
+				log.Printf("alerts: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (a *Alerts) Stop() {
+	close(a.stop)
+	<-a.done
+}
+
+// Run evaluates every enabled rule once.
+func (a *Alerts) Run() error {
+	db := a.db()
+	if db == nil {
+		return nil
+	}
+
+	var rules []models.AlertRule
+	if err := db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		result, err := EvaluateAlert(db, rule, now)
+		if err != nil {
+			log.Printf("alerts: rule %s: %v", rule.ID, err)
+			continue
+		}
+
+		updates := map[string]interface{}{
+			"last_value":        result.Value,
+			"last_evaluated_at": now,
+		}
+
+		cooldown := time.Duration(rule.Cooldown) * time.Minute
+		inCooldown := rule.LastTriggeredAt != nil && now.Sub(*rule.LastTriggeredAt) < cooldown
+		if result.Triggered && !inCooldown {
+			ctx, cancel := context.WithTimeout(context.Background(), alertSendTimeout)
+			err := a.notifiers.Send(ctx, rule.Channel, rule.Target, AlertMessage(rule, result))
+			cancel()
+			if err != nil {
+				log.Printf("alerts: rule %s: could not notify via %s: %v", rule.ID, rule.Channel, err)
+			} else {
+				updates["last_triggered_at"] = now
+			}
+		}
+
+		if err := db.Model(&models.AlertRule{}).Where("id = ?", rule.ID).Updates(updates).Error; err != nil {
+			log.Printf("alerts: rule %s: %v", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// AlertResult is the outcome of evaluating a rule. Baseline is only set for
+// drop and spike rules.
+type AlertResult struct {
+	Value     float64
+	Baseline  float64
+	Triggered bool
+}
+
+// EvaluateAlert measures the rule's metric over the window ending at now
+// and checks its condition. Drop and spike rules never trigger without a
+// baseline, e.g. for a project that just started tracking.
+func EvaluateAlert(db *gorm.DB, rule models.AlertRule, now time.Time) (AlertResult, error) {
+	window := time.Duration(rule.Window) * time.Minute
+
+	value, err := alertMetric(db, rule, now.Add(-window), now)
+	if err != nil {
+		return AlertResult{}, err
+	}
+	result := AlertResult{Value: value}
+
+	switch rule.Condition {
+	case models.AlertAbove:
+		result.Triggered = value > rule.Threshold
+	case models.AlertBelow:
+		result.Triggered = value < rule.Threshold
+	case models.AlertDrop, models.AlertSpike:
+		days := rule.BaselineDays
+		if days < 1 {
+			days = 7
+		}
+		var sum float64
+		for k := 1; k <= days; k++ {
+			end := now.Add(-time.Duration(k) * day)
+			v, err := alertMetric(db, rule, end.Add(-window), end)
+			if err != nil {
+				return AlertResult{}, err
+			}
+			sum += v
+		}
+		result.Baseline = sum / float64(days)
+		if result.Baseline == 0 {
+			return result, nil
+		}
+		if rule.Condition == models.AlertDrop {
+			result.Triggered = value < result.Baseline*(1-rule.Threshold/100)
+		} else {
+			result.Triggered = value > result.Baseline*(1+rule.Threshold/100)
+		}
+	default:
+		return AlertResult{}, fmt.Errorf("unknown condition %q", rule.Condition)
+	}
+	return result, nil
+}
+
+func alertMetric(db *gorm.DB, rule models.AlertRule, start, end time.Time) (float64, error) {
+	var count int64
+	var err error
+	switch rule.Metric {
+	case models.AlertVisitors:
+		err = db.Model(&models.PageView{}).
+			Where("project_id = ? AND created_at >= ? AND created_at < ?", rule.ProjectID, start, end).
+			Distinct("visitor_id").
+			Count(&count).Error
+	case models.AlertViews:
+		err = db.Model(&models.PageView{}).
+			Where("project_id = ? AND created_at >= ? AND created_at < ?", rule.ProjectID, start, end).
+			Count(&count).Error
+	case models.AlertEvents:
+		err = db.Model(&models.AnalyticsEvent{}).
+			Where("project_id = ? AND event_name = ? AND created_at >= ? AND created_at < ?", rule.ProjectID, rule.EventName, start, end).
+			Count(&count).Error
+	default:
+		err = fmt.Errorf("unknown metric %q", rule.Metric)
+	}
+	return float64(count), err
+}
+
+// AlertMessage describes a triggered rule.
+func AlertMessage(rule models.AlertRule, result AlertResult) notify.Message {
+	metric := "Visitors"
+	switch rule.Metric {
+	case models.AlertViews:
+		metric = "Page views"
+	case models.AlertEvents:
+		metric = fmt.Sprintf("%q events", rule.EventName)
+	}
+
+	body := fmt.Sprintf("%s in the last %s: %.0f", metric, formatWindow(rule.Window), result.Value)
+	switch rule.Condition {
+	case models.AlertAbove:
+		body += fmt.Sprintf(", above the threshold of %g.", rule.Threshold)
+	case models.AlertBelow:
+		body += fmt.Sprintf(", below the threshold of %g.", rule.Threshold)
+	case models.AlertDrop, models.AlertSpike:
+		change := 0.0
+		if result.Baseline > 0 {
+			change = (result.Value - result.Baseline) / result.Baseline * 100
+		}
+		body += fmt.Sprintf(", %+.0f%% compared to the average of %.1f over the previous days.", change, result.Baseline)
+	}
+
+	ruleID := rule.ID
+	return notify.Message{
+		ProjectID: rule.ProjectID,
+		RuleID:    &ruleID,
+		Title:     "Alert: " + rule.Name,
+		Body:      body,
+		Data: map[string]interface{}{
+			"metric":    rule.Metric,
+			"event":     rule.EventName,
+			"condition": rule.Condition,
+			"threshold": rule.Threshold,
+			"window":    rule.Window,
+			"value":     result.Value,
+			"baseline":  result.Baseline,
+		},
+		CreatedAt: time.Now(),
+	}
+}
+
+func formatWindow(minutes int) string {
+	unit, n := "minute", minutes
+	switch {
+	case minutes%(24*60) == 0:
+		unit, n = "day", minutes/(24*60)
+	case minutes%60 == 0:
+		unit, n = "hour", minutes/60
+	}
+	if n == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,280 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"jiramo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Span splits a time range into the whole UTC days the rollup job has
+// finalized, [DayStart, DayEnd), and the windows around them that are
+// read from raw rows.
+type Span struct {
+	DayStart time.Time
+	DayEnd   time.Time
+	Raw      [][2]time.Time
+}
+
+// SplitRange splits [from, end) at the finalized days. Without any, the
+// whole range is raw.
+func SplitRange(db *gorm.DB, from, end time.Time) Span {
+	dayStart := from.UTC().Truncate(day)
+	if dayStart.Before(from) {
+		dayStart = dayStart.Add(day)
+	}
+	dayEnd := end.UTC().Truncate(day)
+	if wm := Watermark(db).Truncate(day); wm.Before(dayEnd) {
+		dayEnd = wm
+	}
+
+	if !dayStart.Before(dayEnd) {
+		return RawSpan(from, end)
+	}
+	span := Span{DayStart: dayStart, DayEnd: dayEnd}
+	for _, window := range [][2]time.Time{{from, dayStart}, {dayEnd, end}} {
+		if window[0].Before(window[1]) {
+			span.Raw = append(span.Raw, window)
+		}
+	}
+	return span
+}
+
+// RawSpan reads all of [from, end) from raw rows, for queries the rollups
+// cannot answer.
+func RawSpan(from, end time.Time) Span {
+	return Span{Raw: [][2]time.Time{{from, end}}}
+}
+
+// TopSpan is SplitRange for a report read from the dimension rollups of
+// dimension, which keep only the top values of each day. Values past them
+// are missing on the days that hit the cap, so when deep is set, for a
+// search or a page beyond the first ones, those days are read from raw
+// rows as long as raw rows still cover them. partial reports whether days
+// that hit the cap are still read from the rollups.
+func TopSpan(db *gorm.DB, projectID, dimension string, from, end time.Time, deep bool) (span Span, partial bool, err error) {
+	span = SplitRange(db, from, end)
+	if !span.HasDays() {
+		return span, false, nil
+	}
+
+	var capped []time.Time
+	err = db.Model(&models.DimensionRollup{}).
+		Where("project_id = ? AND dimension = ? AND bucket >= ? AND bucket < ?", projectID, dimension, span.DayStart, span.DayEnd).
+		Group("bucket").
+		Having("COUNT(*) >= ?", TopDimensionValues).
+		Order("bucket").
+		Pluck("bucket", &capped).Error
+	if err != nil || len(capped) == 0 || !deep {
+		return span, len(capped) > 0, err
+	}
+
+	var oldest *time.Time
+	err = db.Model(&models.PageView{}).Where("project_id = ?", projectID).
+		Select("MIN(created_at)").Scan(&oldest).Error
+	if err != nil || oldest == nil {
+		return span, true, err
+	}
+	covered := oldest.UTC().Truncate(day)
+	if covered.Before(*oldest) {
+		covered = covered.Add(day)
+	}
+
+	for _, d := range capped {
+		if !d.Before(covered) {
+			span.rawFrom(d)
+			break
+		}
+	}
+	return span, capped[0].Before(span.DayEnd), nil
+}
+
+// rawFrom moves the days from cut on to the raw windows.
+func (s *Span) rawFrom(cut time.Time) {
+	if cut.Before(s.DayStart) {
+		cut = s.DayStart
+	}
+	if !cut.Before(s.DayEnd) {
+		return
+	}
+	if n := len(s.Raw); n > 0 && s.Raw[n-1][0].Equal(s.DayEnd) {
+		s.Raw[n-1][0] = cut
+	} else {
+		s.Raw = append(s.Raw, [2]time.Time{cut, s.DayEnd})
+	}
+	s.DayEnd = cut
+}
+
+// HasDays reports whether part of the span is read from the rollups.
+func (s Span) HasDays() bool {
+	return s.DayStart.Before(s.DayEnd)
+}
+
+// SQL joins with UNION ALL the rolled query, which reads the days between
+// @day_start and @day_end, and the raw query of every raw window. raw is
+// given a function rendering the condition that a created_at column falls
+// within the window. The bounds are bound in args.
+func (s Span) SQL(args map[string]interface{}, rolled string, raw func(within func(column string) string) string) string {
+	var parts []string
+	if s.HasDays() {
+		args["day_start"], args["day_end"] = s.DayStart, s.DayEnd
+		parts = append(parts, rolled)
+	}
+	for i, window := range s.Raw {
+		from, to := fmt.Sprintf("raw%d_from", i), fmt.Sprintf("raw%d_to", i)
+		args[from], args[to] = window[0], window[1]
+		parts = append(parts, raw(func(column string) string {
+			return column + " >= @" + from + " AND " + column + " < @" + to
+		}))
+	}
+	return strings.Join(parts, "\n\t\tUNION ALL\n")
+}
+
+// BreakdownQuery selects the rows of a breakdown.
+type BreakdownQuery struct {
+	Dimension string
+	Filters   map[string]string
+	Search    string
+	Limit     int
+	Offset    int
+
+	// Values restricts the breakdown to these values, e.g. to compare the
+	// rows of a page against an earlier period.
+	Values []string
+}
+
+// BreakdownRow is the traffic of one value of a dimension.
+type BreakdownRow struct {
+	Value       string  `json:"value"`
+	Visitors    int64   `json:"visitors"`
+	Views       int64   `json:"views"`
+	Sessions    int64   `json:"sessions"`
+	BounceRate  float64 `json:"bounce_rate"`
+	AvgDuration float64 `json:"avg_duration"`
+}
+
+// Breakdown groups the page views of a project in [from, to] by a
+// dimension. Bounce rate and average duration are computed over the
+// sessions in which the value was seen, so a page's bounce rate is the
+// share of its sessions that viewed a single page.
+//
+// Finalized days are read from the dimension rollups, which keep the top
+// values of each day, and visitors are summed per day like in
+// ProjectTotals. The rollups are not broken down by other dimensions, so a
+// filtered breakdown is computed from raw rows only. A search or a page past
+// the top values reads the days that hit the cap from raw rows; partial
+// reports that some of them are no longer covered, see TopSpan.
+func Breakdown(db *gorm.DB, projectID string, from, to time.Time, q BreakdownQuery) (rows []BreakdownRow, partial bool, err error) {
+	parts, args, partial, err := breakdownParts(db, projectID, from, to, q)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = db.Raw(`
+		SELECT value,
+			SUM(visitors) AS visitors,
+			SUM(views) AS views,
+			SUM(sessions) AS sessions,
+			COALESCE(SUM(bounces) * 100.0 / NULLIF(SUM(sessions), 0), 0) AS bounce_rate,
+			COALESCE(SUM(duration) * 1.0 / NULLIF(SUM(sessions), 0), 0) AS avg_duration
+		FROM (`+parts+`
+		) parts
+		GROUP BY value
+		ORDER BY visitors DESC, views DESC, value
+		LIMIT @limit OFFSET @offset`, args).Scan(&rows).Error
+	return rows, partial, err
+}
+
+// CountBreakdown returns how many values the breakdown of q has over all
+// pages. It reads the same rows as Breakdown for q, so it falls short
+// exactly when Breakdown reports partial results.
+func CountBreakdown(db *gorm.DB, projectID string, from, to time.Time, q BreakdownQuery) (int64, error) {
+	parts, args, _, err := breakdownParts(db, projectID, from, to, q)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = db.Raw(`SELECT COUNT(DISTINCT value) FROM (`+parts+`
+		) parts`, args).Scan(&total).Error
+	return total, err
+}
+
+// breakdownParts renders the rolled and raw parts of a breakdown, each
+// grouped by value, and their arguments.
+func breakdownParts(db *gorm.DB, projectID string, from, to time.Time, q BreakdownQuery) (string, map[string]interface{}, bool, error) {
+	args := map[string]interface{}{
+		"project":   projectID,
+		"dimension": q.Dimension,
+		"limit":     q.Limit,
+		"offset":    q.Offset,
+	}
+
+	end := to.Add(time.Second)
+	span, partial := RawSpan(from, end), false
+	if len(q.Filters) == 0 {
+		deep := q.Search != "" || q.Offset+q.Limit > TopDimensionValues
+		var err error
+		if span, partial, err = TopSpan(db, projectID, q.Dimension, from, end, deep); err != nil {
+			return "", nil, false, err
+		}
+	}
+
+	valueExpr := Dimensions[q.Dimension]
+	rawWhere, rolledWhere := DimensionFilterSQL(q.Filters, args), ""
+	if q.Search != "" {
+		rawWhere += " AND " + valueExpr + ` ILIKE @search ESCAPE '\'`
+		rolledWhere += ` AND value ILIKE @search ESCAPE '\'`
+		args["search"] = "%" + EscapeLike(q.Search) + "%"
+	}
+	if len(q.Values) > 0 {
+		rawWhere += " AND " + valueExpr + " IN @values"
+		rolledWhere += " AND value IN @values"
+		args["values"] = q.Values
+	}
+
+	parts := span.SQL(args, `
+		SELECT value, views, visitors, sessions, bounces, duration
+		FROM dimension_rollups
+		WHERE project_id = @project AND dimension = @dimension
+			AND bucket >= @day_start AND bucket < @day_end`+rolledWhere,
+		func(within func(string) string) string {
+			return `
+		SELECT ps.value,
+			SUM(ps.views) AS views,
+			COUNT(DISTINCT ps.visitor_id) AS visitors,
+			COUNT(*) AS sessions,
+			COUNT(*) FILTER (WHERE sess.views = 1) AS bounces,
+			COALESCE(SUM(sess.duration), 0) AS duration
+		FROM (
+			SELECT ` + valueExpr + ` AS value, pv.session_id, MIN(pv.visitor_id) AS visitor_id, COUNT(*) AS views
+			FROM page_views pv
+			LEFT JOIN sessions s ON s.session_id = pv.session_id
+			WHERE pv.project_id = @project AND ` + within("pv.created_at") + rawWhere + `
+			GROUP BY 1, pv.session_id
+		) ps
+		JOIN (
+			SELECT session_id, COUNT(*) AS views, COALESCE(SUM(duration), 0) AS duration
+			FROM page_views
+			WHERE project_id = @project AND ` + within("created_at") + `
+			GROUP BY session_id
+		) sess ON sess.session_id = ps.session_id
+		GROUP BY ps.value`
+		})
+	return parts, args, partial, nil
+}
+
+// DimensionFilterSQL renders filters as AND clauses over pv/s, adding the
+// bound values to args.
+func DimensionFilterSQL(filters map[string]string, args map[string]interface{}) string {
+	var sb strings.Builder
+	for dimension, value := range filters {
+		param := "f_" + dimension
+		sb.WriteString(" AND " + Dimensions[dimension] + " = @" + param)
+		args[param] = value
+	}
+	return sb.String()
+}
@@ -0,0 +1,30 @@
+package analytics
+
+// Dimensions maps a public dimension name to the SQL expression it groups
+// by. Expressions may reference page_views as pv and sessions as s. They are
+// used with named parameters, so a literal question mark must be written as
+// \x3f or GORM treats it as a placeholder.
+var Dimensions = map[string]string{
+	"page":         "pv.path",
+	"hostname":     "COALESCE(s.hostname, '')",
+	"referrer":     `COALESCE(regexp_replace(s.referrer, '^[a-zA-Z][a-zA-Z0-9+.-]*://(www\.)*([^/:#\x3f]*).*$', '\2'), '')`,
+	"utm_source":   "COALESCE(s.utm_source, '')",
+	"utm_medium":   "COALESCE(s.utm_medium, '')",
+	"utm_campaign": "COALESCE(s.utm_campaign, '')",
+	"channel":      "COALESCE(s.channel, '')",
+	"browser":      "COALESCE(s.browser, '')",
+	"os":           "COALESCE(s.os, '')",
+	"device":       "COALESCE(s.device, '')",
+	"language":     "COALESCE(s.language, '')",
+	"country":      "COALESCE(s.country, '')",
+	"region":       "COALESCE(s.region, '')",
+	"city":         "COALESCE(s.city, '')",
+}
+
+// EntryPageDimension and ExitPageDimension name the daily rollups of the
+// entry and exit page reports. They rank the pages sessions started or
+// ended on and cannot be used as breakdown dimensions or filters.
+const (
+	EntryPageDimension = "entry_page"
+	ExitPageDimension  = "exit_page"
+)
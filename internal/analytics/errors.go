@@ -0,0 +1,132 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// fingerprintFrames is how many frames from the top of the stack
+	// identify an error.
+	fingerprintFrames = 5
+
+	MaxErrorMessageLength = 1000
+	MaxErrorStackLength   = 16 * 1024
+)
+
+// StackFrame is a parsed line of a JavaScript stack trace.
+type StackFrame struct {
+	Function string
+	File     string
+}
+
+var (
+	// "    at fn (https://example.com/app.js:10:5)" or "    at https://example.com/app.js:10:5"
+	chromeFrame = regexp.MustCompile(`^\s*at (?:(.+?) \()?(.+?)(?::\d+)?(?::\d+)?\)?$`)
+	// "fn@https://example.com/app.js:10:5" (Firefox, Safari)
+	geckoFrame = regexp.MustCompile(`^\s*(.*?)@(.+?)(?::\d+)?(?::\d+)?$`)
+
+	errorType    = regexp.MustCompile(`^(?:Uncaught )?([A-Z][A-Za-z]*(?:Error|Exception))\b:?`)
+	bundleHash   = regexp.MustCompile(`[.-]([A-Za-z0-9_]{6,})((?:\.[a-z]+)+)$`)
+	hashOrUUID   = regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\b`)
+	quoted       = regexp.MustCompile(`'[^']*'|"[^"]*"|` + "`[^`]*`")
+	numberInText = regexp.MustCompile(`\d+`)
+)
+
+// ParseStack extracts the frames of a Chrome, Firefox or Safari stack
+// trace, top first. Lines that are not frames, such as the message line
+// Chrome puts first, are skipped.
+func ParseStack(stack string) []StackFrame {
+	var frames []StackFrame
+	for _, line := range strings.Split(stack, "\n") {
+		line = strings.TrimRight(line, "\r")
+		var m []string
+		if strings.HasPrefix(strings.TrimSpace(line), "at ") {
+			m = chromeFrame.FindStringSubmatch(line)
+		} else if strings.Contains(line, "@") {
+			m = geckoFrame.FindStringSubmatch(line)
+			// Not a frame but a message line that happens to hold an @.
+			if m != nil && !strings.Contains(m[2], "/") {
+				m = nil
+			}
+		}
+		if m == nil {
+			continue
+		}
+		frames = append(frames, StackFrame{Function: strings.TrimSpace(m[1]), File: normalizeFile(m[2])})
+	}
+	return frames
+}
+
+// normalizeFile keeps the path of a script URL without query, fragment and
+// bundler content hash, so frames stay stable across deploys and hosts.
+func normalizeFile(file string) string {
+	if u, err := url.Parse(file); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		file = u.Path
+	}
+	if m := bundleHash.FindStringSubmatchIndex(file); m != nil && strings.ContainsAny(file[m[2]:m[3]], "0123456789") {
+		file = file[:m[0]] + file[m[4]:]
+	}
+	return file
+}
+
+// inApp reports whether a frame belongs to the site rather than to a browser
+// extension or the engine.
+func (f StackFrame) inApp() bool {
+	for _, prefix := range []string{"chrome-extension:", "moz-extension:", "safari-extension:", "safari-web-extension:", "<anonymous>", "native", "[native code]"} {
+		if strings.HasPrefix(f.File, prefix) {
+			return false
+		}
+	}
+	return f.File != ""
+}
+
+// ErrorType returns the error class named at the start of a message, such
+// as TypeError, or "Error".
+func ErrorType(message string) string {
+	if m := errorType.FindStringSubmatch(message); m != nil {
+		return m[1]
+	}
+	return "Error"
+}
+
+// ErrorFingerprint identifies the issue an error belongs to. It hashes the
+// error type and the function and file of the top frames of the site's own
+// code, leaving out line numbers. Without a usable stack it falls back to
+// the message with numbers, identifiers and quoted values masked.
+func ErrorFingerprint(message, stack string) (fingerprint, culprit string) {
+	var parts []string
+	for _, frame := range ParseStack(stack) {
+		if !frame.inApp() {
+			continue
+		}
+		if culprit == "" {
+			culprit = frame.File
+			if frame.Function != "" {
+				culprit = frame.Function + " (" + frame.File + ")"
+			}
+		}
+		parts = append(parts, frame.Function+"|"+frame.File)
+		if len(parts) == fingerprintFrames {
+			break
+		}
+	}
+
+	key := ErrorType(message) + "\n"
+	if len(parts) > 0 {
+		key += strings.Join(parts, "\n")
+	} else {
+		key += normalizeMessage(message)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]), culprit
+}
+
+func normalizeMessage(message string) string {
+	message = hashOrUUID.ReplaceAllString(message, "<id>")
+	message = quoted.ReplaceAllString(message, "<s>")
+	return numberInText.ReplaceAllString(message, "<n>")
+}
@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"strings"
+	"time"
+
+	"jiramo/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type GoalConversion struct {
+	Goal           models.Goal `json:"goal"`
+	Visitors       int64       `json:"visitors"`
+	Conversions    int64       `json:"conversions"`
+	ConversionRate float64     `json:"conversion_rate"`
+}
+
+// GoalConversions counts, for each goal, the distinct visitors that reached
+// it and the total number of matching hits. The conversion rate is relative
+// to all visitors of the project in the range.
+func GoalConversions(db *gorm.DB, projectID uuid.UUID, goals []models.Goal, from, to time.Time) ([]GoalConversion, error) {
+	var totalVisitors int64
+	err := db.Model(&models.PageView{}).
+		Where("project_id = ? AND created_at BETWEEN ? AND ?", projectID, from, to).
+		Distinct("visitor_id").
+		Count(&totalVisitors).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]GoalConversion, 0, len(goals))
+	for _, goal := range goals {
+		table, cond, arg := GoalMatch(goal.Type, goal.PathPattern, goal.EventName)
+
+		var counts struct {
+			Visitors    int64
+			Conversions int64
+		}
+		err := db.Raw(`
+			SELECT COUNT(DISTINCT visitor_id) AS visitors, COUNT(*) AS conversions
+			FROM `+table+`
+			WHERE project_id = ? AND created_at BETWEEN ? AND ? AND `+cond,
+			projectID, from, to, arg).Scan(&counts).Error
+		if err != nil {
+			return nil, err
+		}
+
+		rate := 0.0
+		if totalVisitors > 0 {
+			rate = float64(counts.Visitors) / float64(totalVisitors) * 100
+		}
+
+		results = append(results, GoalConversion{
+			Goal:           goal,
+			Visitors:       counts.Visitors,
+			Conversions:    counts.Conversions,
+			ConversionRate: rate,
+		})
+	}
+	return results, nil
+}
+
+// GoalMatch returns the table and the condition (with a single placeholder)
+// that select the hits matching a goal or funnel step. Page patterns accept
+// * as a wildcard.
+func GoalMatch(goalType models.GoalType, pathPattern, eventName string) (table, cond string, arg interface{}) {
+	if goalType == models.GoalEvent {
+		return "analytics_events", "event_name = ?", eventName
+	}
+	if !strings.Contains(pathPattern, "*") {
+		return "page_views", "path = ?", pathPattern
+	}
+	pattern := strings.ReplaceAll(EscapeLike(pathPattern), "*", "%")
+	return "page_views", `path LIKE ? ESCAPE '\'`, pattern
+}
+
+// EscapeLike escapes the LIKE wildcards in s, using backslash as the escape
+// character.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"unicode/utf8"
+
+	"jiramo/internal/models"
+)
+
+const (
+	MaxProperties          = 30
+	MaxPropertyValueLength = 500
+	MaxPropertiesSize      = 4096
+)
+
+var propertyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,64}$`)
+
+// ParseProperties decodes and validates the properties of an event: a JSON
+// object of at most MaxProperties keys whose values are strings, finite
+// numbers or booleans. Nulls are dropped. An empty input yields no
+// properties.
+func ParseProperties(data []byte) (models.Properties, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return models.Properties{}, nil
+	}
+	if len(data) > MaxPropertiesSize {
+		return nil, fmt.Errorf("properties exceed %d bytes", MaxPropertiesSize)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.New("properties must be a JSON object")
+	}
+	if len(raw) > MaxProperties {
+		return nil, fmt.Errorf("at most %d properties are allowed", MaxProperties)
+	}
+
+	props := make(models.Properties, len(raw))
+	for key, value := range raw {
+		if !propertyKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid property key %q", key)
+		}
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			if utf8.RuneCountInString(v) > MaxPropertyValueLength {
+				return nil, fmt.Errorf("property %q exceeds %d characters", key, MaxPropertyValueLength)
+			}
+		case float64:
+			if math.IsInf(v, 0) || math.IsNaN(v) {
+				return nil, fmt.Errorf("property %q is not a finite number", key)
+			}
+		case bool:
+		default:
+			return nil, fmt.Errorf("property %q must be a string, number or boolean", key)
+		}
+		props[key] = value
+	}
+	return props, nil
+}
+
+// ValidPropertyKey reports whether key can name an event property.
+func ValidPropertyKey(key string) bool {
+	return propertyKeyPattern.MatchString(key)
+}
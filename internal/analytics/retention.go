@@ -0,0 +1,171 @@
+package analytics
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"jiramo/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MinRetentionDays keeps raw rows around long enough for the rollup job
+	// to have aggregated them for good.
+	MinRetentionDays = 7
+
+	pruneChunk = 5000
+)
+
+// prunedTables lists the raw tables cleared by the retention job and the
+// column compared against the cutoff.
+var prunedTables = []struct {
+	Table  string
+	Column string
+}{
+	{"page_views", "created_at"},
+	{"analytics_events", "created_at"},
+	{"web_vitals", "created_at"},
+	{"error_occurrences", "created_at"},
+	{"sessions", "expires_at"},
+}
+
+// Pruner deletes raw analytics older than each project's retention period.
+// Rollups are left untouched, so historical totals survive.
+type Pruner struct {
+	db          func() *gorm.DB
+	defaultDays int
+	interval    time.Duration
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+func NewPruner(db func() *gorm.DB, defaultDays int, interval time.Duration) *Pruner {
+	if defaultDays < MinRetentionDays {
+		defaultDays = MinRetentionDays
+	}
+	return &Pruner{
+		db:          db,
+		defaultDays: defaultDays,
+		interval:    interval,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (p *Pruner) Start() {
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := p.Run(); err != nil {
+				log.Printf("retention: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (p *Pruner) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+// Run prunes every project once and records what was removed. A project
+// that fails is logged and left for the next run.
+func (p *Pruner) Run() error {
+	db := p.db()
+	if db == nil {
+		return nil
+	}
+
+	var projects []models.Project
+	if err := db.Select("id", "retention_days").Find(&projects).Error; err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err := p.prune(db, project); err != nil {
+			log.Printf("retention: project %s: %v", project.ID, err)
+		}
+	}
+	return nil
+}
+
+// prune removes a project's raw rows past its retention period. What was
+// removed is recorded even when a later table fails.
+func (p *Pruner) prune(db *gorm.DB, project models.Project) error {
+	days := project.RetentionDays
+	if days == 0 {
+		days = p.defaultDays
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	run := models.PruneRun{
+		ID:        uuid.New(),
+		ProjectID: project.ID,
+		Cutoff:    cutoff,
+		CreatedAt: time.Now(),
+	}
+
+	var pruneErr error
+	for _, t := range prunedTables {
+		removed, err := pruneTable(db, t.Table, t.Column, project.ID, cutoff)
+		switch t.Table {
+		case "page_views":
+			run.PageViews = removed
+		case "analytics_events":
+			run.Events = removed
+		case "web_vitals":
+			run.WebVitals = removed
+		case "error_occurrences":
+			run.Errors = removed
+		case "sessions":
+			run.Sessions = removed
+		}
+		if err != nil {
+			pruneErr = fmt.Errorf("%s: %w", t.Table, err)
+			break
+		}
+	}
+
+	if run.PageViews+run.Events+run.WebVitals+run.Errors+run.Sessions == 0 {
+		return pruneErr
+	}
+	log.Printf("retention: project %s: removed %d page views, %d events, %d web vitals, %d errors, %d sessions older than %s",
+		project.ID, run.PageViews, run.Events, run.WebVitals, run.Errors, run.Sessions, cutoff.Format(time.RFC3339))
+	if err := db.Create(&run).Error; err != nil {
+		return err
+	}
+	return pruneErr
+}
+
+// pruneTable deletes rows older than cutoff in chunks, so a large backlog
+// does not hold locks for long, and returns how many were removed.
+func pruneTable(db *gorm.DB, table, column string, projectID uuid.UUID, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		result := db.Exec(`
+			DELETE FROM `+table+` WHERE id IN (
+				SELECT id FROM `+table+`
+				WHERE project_id = ? AND `+column+` < ?
+				LIMIT ?
+			)`, projectID, cutoff, pruneChunk)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < pruneChunk {
+			return total, nil
+		}
+	}
+}
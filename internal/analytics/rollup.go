@@ -0,0 +1,416 @@
+package analytics
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"jiramo/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	rollupStateName = "rollups"
+
+	// rollupLookback is re-aggregated on every run to pick up hits that
+	// were still queued or sessions that kept growing after the last run.
+	rollupLookback = 3 * time.Hour
+	rollupChunk    = 7 * 24 * time.Hour
+
+	// TopDimensionValues is how many values of each dimension are kept
+	// per day.
+	TopDimensionValues = 100
+
+	day = 24 * time.Hour
+)
+
+// Rollups periodically aggregates raw page views and sessions into the
+// hourly and daily rollup tables.
+type Rollups struct {
+	db       func() *gorm.DB
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewRollups(db func() *gorm.DB, interval time.Duration) *Rollups {
+	return &Rollups{
+		db:       db,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *Rollups) Start() {
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := r.Run(); err != nil {
+				log.Printf("rollups: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Rollups) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+// Run aggregates every complete hour since the last watermark, minus the
+// lookback, and every complete day touched by that range.
+func (r *Rollups) Run() error {
+	db := r.db()
+	if db == nil {
+		return nil
+	}
+
+	end := time.Now().UTC().Truncate(time.Hour)
+
+	var state models.RollupState
+	err := db.First(&state, "name = ?", rollupStateName).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var first *time.Time
+		if err := db.Raw("SELECT MIN(created_at) FROM page_views").Scan(&first).Error; err != nil {
+			return err
+		}
+		state = models.RollupState{Name: rollupStateName, Watermark: end}
+		if first != nil {
+			state.Watermark = first.UTC().Truncate(time.Hour).Add(rollupLookback)
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&state).Error; err != nil {
+			return err
+		}
+		if err := db.First(&state, "name = ?", rollupStateName).Error; err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	start := state.Watermark.UTC().Add(-rollupLookback)
+	if err := rewindProjects(db, start); err != nil {
+		return err
+	}
+	if !start.Before(end) {
+		return nil
+	}
+
+	for chunkStart := start; chunkStart.Before(end); chunkStart = chunkStart.Add(rollupChunk) {
+		chunkEnd := chunkStart.Add(rollupChunk)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		if err := rollupRange(db, models.RollupHour, chunkStart, chunkEnd, uuid.Nil); err != nil {
+			return err
+		}
+	}
+
+	for d := start.Truncate(day); !d.Add(day).After(end); d = d.Add(day) {
+		if err := rollupRange(db, models.RollupDay, d, d.Add(day), uuid.Nil); err != nil {
+			return err
+		}
+		if err := rollupDimensions(db, d, uuid.Nil); err != nil {
+			return err
+		}
+	}
+
+	// A rewind during the run lowered the watermark below what was read;
+	// keeping it lets the next run pick those hits up.
+	return db.Model(&models.RollupState{}).
+		Where("name = ? AND watermark = ?", rollupStateName, state.Watermark).
+		Update("watermark", end).Error
+}
+
+// RollupDay aggregates one UTC day of a single project, hours included,
+// whatever the watermark. Imports use it for the days they bring in.
+func RollupDay(db *gorm.DB, projectID uuid.UUID, d time.Time) error {
+	d = d.UTC().Truncate(day)
+	if err := rollupRange(db, models.RollupHour, d, d.Add(day), projectID); err != nil {
+		return err
+	}
+	if err := rollupRange(db, models.RollupDay, d, d.Add(day), projectID); err != nil {
+		return err
+	}
+	return rollupDimensions(db, d, projectID)
+}
+
+// rollupRange upserts the rollups of every project, or of projectID when it
+// is not nil, for the buckets of the given granularity within [start, end).
+func rollupRange(db *gorm.DB, granularity models.RollupGranularity, start, end time.Time, projectID uuid.UUID) error {
+	viewScope, sessionScope := "", ""
+	if projectID != uuid.Nil {
+		viewScope = " AND project_id = @project"
+		sessionScope = " AND s.project_id = @project"
+	}
+	return db.Exec(`
+		INSERT INTO rollups (project_id, granularity, bucket, views, visitors, sessions, bounces, duration, updated_at)
+		SELECT project_id, CAST(@granularity AS text), bucket,
+			SUM(views), SUM(visitors), SUM(sessions), SUM(bounces), SUM(duration), NOW()
+		FROM (
+			SELECT project_id,
+				date_trunc(@granularity, created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,
+				COUNT(*) AS views,
+				COUNT(DISTINCT visitor_id) AS visitors,
+				0 AS sessions,
+				0 AS bounces,
+				COALESCE(SUM(duration), 0) AS duration
+			FROM page_views
+			WHERE created_at >= @start AND created_at < @end`+viewScope+`
+			GROUP BY 1, 2
+			UNION ALL
+			SELECT s.project_id,
+				date_trunc(@granularity, s.created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,
+				0, 0,
+				COUNT(*),
+				COUNT(*) FILTER (WHERE pv.views = 1),
+				0
+			FROM sessions s
+			LEFT JOIN LATERAL (
+				SELECT COUNT(*) AS views FROM page_views WHERE session_id = s.session_id
+			) pv ON true
+			WHERE s.created_at >= @start AND s.created_at < @end`+sessionScope+`
+			GROUP BY 1, 2
+		) totals
+		GROUP BY project_id, bucket
+		ON CONFLICT (project_id, granularity, bucket) DO UPDATE SET
+			views = EXCLUDED.views,
+			visitors = EXCLUDED.visitors,
+			sessions = EXCLUDED.sessions,
+			bounces = EXCLUDED.bounces,
+			duration = EXCLUDED.duration,
+			updated_at = EXCLUDED.updated_at`,
+		map[string]interface{}{
+			"granularity": string(granularity),
+			"start":       start,
+			"end":         end,
+			"project":     projectID,
+		}).Error
+}
+
+// rollupDimensions replaces the top values of every dimension, and of the
+// entry and exit pages, for the day starting at d, for every project or
+// only projectID when it is not nil. Imported rows are kept: a day is
+// imported only when it has no other data.
+func rollupDimensions(db *gorm.DB, d time.Time, projectID uuid.UUID) error {
+	names := make([]string, 0, len(Dimensions))
+	for name := range Dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hitScope, viewScope := "", ""
+	if projectID != uuid.Nil {
+		hitScope = " AND pv.project_id = @project"
+		viewScope = " AND project_id = @project"
+	}
+
+	statements := make(map[string]string, len(names)+2)
+	for _, name := range names {
+		statements[name] = `
+			WITH hits AS (
+				SELECT pv.project_id, ` + Dimensions[name] + ` AS value, pv.session_id, pv.visitor_id
+				FROM page_views pv
+				LEFT JOIN sessions s ON s.session_id = pv.session_id
+				WHERE pv.created_at >= @start AND pv.created_at < @end` + hitScope + `
+			),
+			per_session AS (
+				SELECT project_id, value, session_id, MIN(visitor_id) AS visitor_id, COUNT(*) AS views
+				FROM hits
+				GROUP BY project_id, value, session_id
+			),
+			sess AS (
+				SELECT session_id, COUNT(*) AS views, COALESCE(SUM(duration), 0) AS duration
+				FROM page_views
+				WHERE created_at >= @start AND created_at < @end` + viewScope + `
+				GROUP BY session_id
+			),
+			ranked AS (
+				SELECT ps.project_id, ps.value,
+					SUM(ps.views) AS views,
+					COUNT(DISTINCT ps.visitor_id) AS visitors,
+					COUNT(*) AS sessions,
+					COUNT(*) FILTER (WHERE sess.views = 1) AS bounces,
+					SUM(sess.duration) AS duration,
+					row_number() OVER (
+						PARTITION BY ps.project_id
+						ORDER BY COUNT(DISTINCT ps.visitor_id) DESC, SUM(ps.views) DESC
+					) AS rank
+				FROM per_session ps
+				JOIN sess ON sess.session_id = ps.session_id
+				GROUP BY ps.project_id, ps.value
+			)`
+	}
+	// Sessions counts the sessions that started on the page; views and
+	// duration are those of these sessions.
+	statements[EntryPageDimension] = `
+		WITH views AS (
+			SELECT project_id, session_id, visitor_id, path, duration, created_at
+			FROM page_views
+			WHERE created_at >= @start AND created_at < @end` + viewScope + `
+		),
+		firsts AS (
+			SELECT DISTINCT ON (session_id) project_id, session_id, visitor_id, path
+			FROM views
+			ORDER BY session_id, created_at
+		),
+		sess AS (
+			SELECT session_id, COUNT(*) AS views, COALESCE(SUM(duration), 0) AS duration
+			FROM views
+			GROUP BY session_id
+		),
+		ranked AS (
+			SELECT f.project_id, f.path AS value,
+				SUM(sess.views) AS views,
+				COUNT(DISTINCT f.visitor_id) AS visitors,
+				COUNT(*) AS sessions,
+				COUNT(*) FILTER (WHERE sess.views = 1) AS bounces,
+				SUM(sess.duration) AS duration,
+				row_number() OVER (PARTITION BY f.project_id ORDER BY COUNT(*) DESC, f.path) AS rank
+			FROM firsts f
+			JOIN sess ON sess.session_id = f.session_id
+			GROUP BY f.project_id, f.path
+		)`
+	// Sessions counts the sessions that ended on the page, and views all
+	// views of the page, so that the exit rate can be derived.
+	statements[ExitPageDimension] = `
+		WITH views AS (
+			SELECT project_id, session_id, visitor_id, path, created_at
+			FROM page_views
+			WHERE created_at >= @start AND created_at < @end` + viewScope + `
+		),
+		lasts AS (
+			SELECT DISTINCT ON (session_id) project_id, session_id, visitor_id, path
+			FROM views
+			ORDER BY session_id, created_at DESC
+		),
+		per_page AS (
+			SELECT project_id, path, COUNT(*) AS views
+			FROM views
+			GROUP BY project_id, path
+		),
+		ranked AS (
+			SELECT l.project_id, l.path AS value,
+				MAX(p.views) AS views,
+				COUNT(DISTINCT l.visitor_id) AS visitors,
+				COUNT(*) AS sessions,
+				0 AS bounces,
+				0 AS duration,
+				row_number() OVER (PARTITION BY l.project_id ORDER BY COUNT(*) DESC, l.path) AS rank
+			FROM lasts l
+			JOIN per_page p ON p.project_id = l.project_id AND p.path = l.path
+			GROUP BY l.project_id, l.path
+		)`
+	names = append(names, EntryPageDimension, ExitPageDimension)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		existing := tx.Where("bucket = ? AND import_id IS NULL", d)
+		if projectID != uuid.Nil {
+			existing = existing.Where("project_id = ?", projectID)
+		}
+		if err := existing.Delete(&models.DimensionRollup{}).Error; err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			err := tx.Exec(statements[name]+`
+				INSERT INTO dimension_rollups (project_id, bucket, dimension, value, views, visitors, sessions, bounces, duration)
+				SELECT project_id, CAST(@start AS timestamptz), CAST(@dimension AS text), value, views, visitors, sessions, bounces, duration
+				FROM ranked
+				WHERE rank <= @top
+				ON CONFLICT DO NOTHING`,
+				map[string]interface{}{
+					"start":     d,
+					"end":       d.Add(day),
+					"dimension": name,
+					"top":       TopDimensionValues,
+					"project":   projectID,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Rewind marks the rollups of a project as stale since the given time, for
+// hits stored with past timestamps. The next run aggregates those days
+// again.
+func Rewind(db *gorm.DB, projectID uuid.UUID, since time.Time) error {
+	mark := models.RollupRewind{ProjectID: projectID, Since: since.UTC(), MarkedAt: time.Now()}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "project_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"since":     gorm.Expr("LEAST(rollup_rewinds.since, EXCLUDED.since)"),
+			"marked_at": gorm.Expr("EXCLUDED.marked_at"),
+		}),
+	}).Create(&mark).Error
+}
+
+// rewindProjects aggregates again, project by project, the days of every
+// rewind mark up to start, from where the run takes over. A mark is only
+// removed if it was not renewed in the meantime.
+func rewindProjects(db *gorm.DB, start time.Time) error {
+	var marks []models.RollupRewind
+	if err := db.Find(&marks).Error; err != nil {
+		return err
+	}
+
+	for _, mark := range marks {
+		for d := mark.Since.UTC().Truncate(day); d.Before(start); d = d.Add(day) {
+			if err := RollupDay(db, mark.ProjectID, d); err != nil {
+				return err
+			}
+		}
+		err := db.Where("project_id = ? AND marked_at = ?", mark.ProjectID, mark.MarkedAt).
+			Delete(&models.RollupRewind{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watermark returns the time up to which rollups are final, or the zero
+// time if the job has not run yet.
+func Watermark(db *gorm.DB) time.Time {
+	var state models.RollupState
+	if err := db.First(&state, "name = ?", rollupStateName).Error; err != nil {
+		return time.Time{}
+	}
+	return state.Watermark.UTC()
+}
+
+// RollupBuckets returns the rollups of a project with the given granularity
+// for buckets in [from, to), keyed by the bucket's Unix time.
+func RollupBuckets(db *gorm.DB, projectID string, granularity models.RollupGranularity, from, to time.Time) (map[int64]models.Rollup, error) {
+	var rows []models.Rollup
+	err := db.
+		Where("project_id = ? AND granularity = ? AND bucket >= ? AND bucket < ?", projectID, granularity, from, to).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[int64]models.Rollup, len(rows))
+	for _, row := range rows {
+		buckets[row.Bucket.Unix()] = row
+	}
+	return buckets, nil
+}
@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Totals are the headline metrics of a project over a time range.
+type Totals struct {
+	Views    int64
+	Visitors int64
+	Sessions int64
+	Bounces  int64
+	Duration int64
+}
+
+func (t *Totals) add(o Totals) {
+	t.Views += o.Views
+	t.Visitors += o.Visitors
+	t.Sessions += o.Sessions
+	t.Bounces += o.Bounces
+	t.Duration += o.Duration
+}
+
+// BounceRate is the percentage of sessions that viewed a single page.
+func (t Totals) BounceRate() float64 {
+	if t.Sessions == 0 {
+		return 0
+	}
+	return float64(t.Bounces) / float64(t.Sessions) * 100
+}
+
+// AvgDuration is the average time in seconds spent per session.
+func (t Totals) AvgDuration() float64 {
+	if t.Sessions == 0 {
+		return 0
+	}
+	return float64(t.Duration) / float64(t.Sessions)
+}
+
+// ProjectTotals computes the totals of a project for [from, to]. Whole UTC
+// days already covered by the rollup job are read from the daily rollups;
+// only the partial days at either end are counted from raw rows. Visitors
+// are summed per day, so a visitor active on two days counts twice.
+func ProjectTotals(db *gorm.DB, projectID string, from, to time.Time) (Totals, error) {
+	span := SplitRange(db, from, to.Add(time.Second))
+
+	var totals Totals
+	if span.HasDays() {
+		err := db.Raw(`
+			SELECT COALESCE(SUM(views), 0) AS views,
+				COALESCE(SUM(visitors), 0) AS visitors,
+				COALESCE(SUM(sessions), 0) AS sessions,
+				COALESCE(SUM(bounces), 0) AS bounces,
+				COALESCE(SUM(duration), 0) AS duration
+			FROM rollups
+			WHERE project_id = ? AND granularity = 'day' AND bucket >= ? AND bucket < ?`,
+			projectID, span.DayStart, span.DayEnd).Scan(&totals).Error
+		if err != nil {
+			return Totals{}, err
+		}
+	}
+
+	for _, window := range span.Raw {
+		raw, err := rawTotals(db, projectID, window[0], window[1])
+		if err != nil {
+			return Totals{}, err
+		}
+		totals.add(raw)
+	}
+	return totals, nil
+}
+
+// rawTotals counts [start, end) straight from page_views and sessions,
+// with the same session attribution as the rollups.
+func rawTotals(db *gorm.DB, projectID string, start, end time.Time) (Totals, error) {
+	var totals Totals
+	err := db.Raw(`
+		SELECT COUNT(*) AS views,
+			COUNT(DISTINCT visitor_id) AS visitors,
+			COALESCE(SUM(duration), 0) AS duration
+		FROM page_views
+		WHERE project_id = ? AND created_at >= ? AND created_at < ?`,
+		projectID, start, end).Scan(&totals).Error
+	if err != nil {
+		return Totals{}, err
+	}
+
+	var sessions struct {
+		Sessions int64
+		Bounces  int64
+	}
+	err = db.Raw(`
+		SELECT COUNT(*) AS sessions, COUNT(*) FILTER (WHERE pv.views = 1) AS bounces
+		FROM sessions s
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) AS views FROM page_views WHERE session_id = s.session_id
+		) pv ON true
+		WHERE s.project_id = ? AND s.created_at >= ? AND s.created_at < ?`,
+		projectID, start, end).Scan(&sessions).Error
+	if err != nil {
+		return Totals{}, err
+	}
+
+	totals.Sessions = sessions.Sessions
+	totals.Bounces = sessions.Bounces
+	return totals, nil
+}
@@ -0,0 +1,37 @@
+package analytics
+
+import "math"
+
+// Vital describes a Core Web Vitals metric: values up to Good are rated
+// good, values above Poor are rated poor, and Max bounds what is accepted
+// from trackers. Timings are in milliseconds; CLS is unitless.
+type Vital struct {
+	Name string
+	Good float64
+	Poor float64
+	Max  float64
+}
+
+// Vitals lists the collected metrics with Google's published thresholds.
+var Vitals = []Vital{
+	{Name: "LCP", Good: 2500, Poor: 4000, Max: 120000},
+	{Name: "INP", Good: 200, Poor: 500, Max: 60000},
+	{Name: "CLS", Good: 0.1, Poor: 0.25, Max: 100},
+	{Name: "FCP", Good: 1800, Poor: 3000, Max: 120000},
+	{Name: "TTFB", Good: 800, Poor: 1800, Max: 120000},
+}
+
+// LookupVital returns the metric called name.
+func LookupVital(name string) (Vital, bool) {
+	for _, v := range Vitals {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Vital{}, false
+}
+
+// Valid reports whether value is a plausible measurement of the metric.
+func (v Vital) Valid(value float64) bool {
+	return !math.IsNaN(value) && value >= 0 && value <= v.Max
+}
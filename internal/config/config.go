@@ -12,6 +12,17 @@ type Config struct {
 	DB_PORT      string
 	JWT_SECRET   string
 	FRONTEND_URL string
+
+	ANALYTICS_RETENTION_DAYS string
+	BOT_PATTERNS_FILE        string
+	GEOIP_DB_PATH            string
+	IMPORT_DIR               string
+
+	SMTP_HOST     string
+	SMTP_PORT     string
+	SMTP_USERNAME string
+	SMTP_PASSWORD string
+	SMTP_FROM     string
 }
 
 var Global *Config
@@ -25,6 +36,17 @@ func init() {
 		DB_PORT:      getEnv("DB_PORT", "3306"),
 		JWT_SECRET:   getEnv("JWT_SECRET", ""),
 		FRONTEND_URL: getEnv("FRONTEND_URL", "http://localhost:5173"),
+
+		ANALYTICS_RETENTION_DAYS: getEnv("ANALYTICS_RETENTION_DAYS", "395"),
+		BOT_PATTERNS_FILE:        getEnv("BOT_PATTERNS_FILE", ""),
+		GEOIP_DB_PATH:            getEnv("GEOIP_DB_PATH", ""),
+		IMPORT_DIR:               getEnv("IMPORT_DIR", "imports"),
+
+		SMTP_HOST:     getEnv("SMTP_HOST", ""),
+		SMTP_PORT:     getEnv("SMTP_PORT", "587"),
+		SMTP_USERNAME: getEnv("SMTP_USERNAME", ""),
+		SMTP_PASSWORD: getEnv("SMTP_PASSWORD", ""),
+		SMTP_FROM:     getEnv("SMTP_FROM", ""),
 	}
 }
 
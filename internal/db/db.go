@@ -47,11 +47,33 @@ func Connect(user, host, password, name, port string) (*gorm.DB, error) {
 		&models.PageView{},
 		&models.AnalyticsEvent{},
 		&models.APIKey{},
+		&models.Goal{},
+		&models.Funnel{},
+		&models.FunnelStep{},
+		&models.Rollup{},
+		&models.DimensionRollup{},
+		&models.RollupState{},
+		&models.RollupRewind{},
+		&models.PruneRun{},
+		&models.Salt{},
+		&models.FilteredHit{},
+		&models.AlertRule{},
+		&models.Notification{},
+		&models.ReportSubscription{},
+		&models.WebVital{},
+		&models.ErrorGroup{},
+		&models.ErrorOccurrence{},
+		&models.Import{},
 	); err != nil {
 		models.AppState = models.NoDB
 		return nil, err
 	}
 
+	if err := migrateEventData(db); err != nil {
+		models.AppState = models.NoDB
+		return nil, err
+	}
+
 	adminExists, err := AdminExists(db)
 	if err != nil {
 		models.AppState = models.NoDB
@@ -68,3 +90,31 @@ func Connect(user, host, password, name, port string) (*gorm.DB, error) {
 
 	return db, nil
 }
+
+// migrateEventData copies the legacy event_data text column into the
+// properties column wherever it holds a JSON object, then drops it. Rows
+// that do not parse keep empty properties.
+func migrateEventData(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.AnalyticsEvent{}, "event_data") {
+		return nil
+	}
+
+	log.Println("Migrating event_data to properties...")
+	err := db.Exec(`
+		DO $$
+		DECLARE r record;
+		BEGIN
+			FOR r IN SELECT id, event_data FROM analytics_events WHERE event_data LIKE '{%' LOOP
+				BEGIN
+					UPDATE analytics_events SET properties = CAST(r.event_data AS jsonb)
+					WHERE id = r.id AND jsonb_typeof(CAST(r.event_data AS jsonb)) = 'object';
+				EXCEPTION WHEN others THEN
+					NULL;
+				END;
+			END LOOP;
+		END $$`).Error
+	if err != nil {
+		return err
+	}
+	return db.Migrator().DropColumn(&models.AnalyticsEvent{}, "event_data")
+}
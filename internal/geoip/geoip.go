@@ -0,0 +1,79 @@
+// Package geoip resolves IP addresses to a location using a local MaxMind or
+// DB-IP database in the .mmdb format, such as GeoLite2-City or
+// dbip-city-lite. Nothing is sent over the network.
+package geoip
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is the part of a database record kept for analytics. Country is
+// an ISO 3166-1 alpha-2 code; Region and City are English names.
+type Location struct {
+	Country string
+	Region  string
+	City    string
+}
+
+// record is what is decoded of a database entry, in the layout shared by
+// GeoLite2-City and dbip-city-lite.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// Open loads the database at path into memory.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Lookup returns the location of ip. It returns false for unparsable,
+// private or unknown addresses. A nil Reader never finds anything, so
+// callers can skip the lookup when no database is configured.
+func (r *Reader) Lookup(ip string) (Location, bool) {
+	if r == nil {
+		return Location{}, false
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	if err != nil || addr.IsPrivate() || addr.IsLoopback() {
+		return Location{}, false
+	}
+
+	var rec record
+	if err := r.db.Lookup(addr.Unmap().AsSlice(), &rec); err != nil {
+		return Location{}, false
+	}
+
+	loc := Location{
+		Country: rec.Country.ISOCode,
+		City:    rec.City.Names["en"],
+	}
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = rec.Subdivisions[0].Names["en"]
+	}
+	return loc, loc.Country != ""
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"jiramo/internal/analytics"
+	"jiramo/internal/models"
+	"jiramo/internal/notify"
+	"jiramo/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type AlertHandler struct {
+	DB        *gorm.DB
+	Validate  *validator.Validate
+	Notifiers *notify.Registry
+}
+
+func NewAlertHandler(db *gorm.DB, notifiers *notify.Registry) *AlertHandler {
+	return &AlertHandler{DB: db, Validate: validator.New(), Notifiers: notifiers}
+}
+
+type AlertRuleInput struct {
+	Name         string                `json:"name" validate:"required,max=64"`
+	Metric       models.AlertMetric    `json:"metric" validate:"required,oneof=visitors views event"`
+	EventName    string                `json:"event_name" validate:"required_if=Metric event,max=255"`
+	Condition    models.AlertCondition `json:"condition" validate:"required,oneof=above below drop spike"`
+	Threshold    float64               `json:"threshold" validate:"min=0"`
+	Window       int                   `json:"window" validate:"required,min=5,max=10080"`
+	BaselineDays int                   `json:"baseline_days" validate:"omitempty,min=1,max=28"`
+	Cooldown     *int                  `json:"cooldown" validate:"omitempty,min=0,max=10080"`
+	Channel      string                `json:"channel" validate:"required,max=32"`
+	Target       string                `json:"target" validate:"max=2048"`
+}
+
+type UpdateAlertRuleInput struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// GET /projects/{id}/alerts
+func (h *AlertHandler) ListAlertRules(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var rules []models.AlertRule
+	if err := h.DB.Where("project_id = ?", projectID).Order("created_at").Find(&rules).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve alert rules")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"channels": h.Notifiers.Channels(),
+		"rules":    rules,
+	})
+}
+
+// POST /projects/{id}/alerts
+func (h *AlertHandler) CreateAlertRule(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	var input AlertRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := h.Validate.Struct(input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.Notifiers.ValidateTarget(input.Channel, input.Target); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule := models.AlertRule{
+		ID:           uuid.New(),
+		ProjectID:    projectID,
+		Name:         input.Name,
+		Metric:       input.Metric,
+		EventName:    input.EventName,
+		Condition:    input.Condition,
+		Threshold:    input.Threshold,
+		Window:       input.Window,
+		BaselineDays: input.BaselineDays,
+		Cooldown:     60,
+		Channel:      input.Channel,
+		Target:       input.Target,
+		Enabled:      true,
+		CreatedAt:    time.Now(),
+	}
+	if rule.BaselineDays == 0 {
+		rule.BaselineDays = 7
+	}
+	if input.Cooldown != nil {
+		rule.Cooldown = *input.Cooldown
+	}
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during creation")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, rule)
+}
+
+// PATCH /projects/{id}/alerts/{alertId}
+func (h *AlertHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	var input UpdateAlertRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if input.Enabled != nil {
+		if err := h.DB.Model(&rule).Update("enabled", *input.Enabled).Error; err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Error during update")
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rule)
+}
+
+// DELETE /projects/{id}/alerts/{alertId}
+func (h *AlertHandler) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(&rule).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete alert rule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /projects/{id}/alerts/{alertId}/test
+//
+// Evaluates the rule now and sends its notification regardless of the
+// outcome and cooldown, to check the channel end to end.
+func (h *AlertHandler) TestAlertRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := analytics.EvaluateAlert(h.DB, rule, time.Now())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not evaluate alert rule")
+		return
+	}
+
+	msg := analytics.AlertMessage(rule, result)
+	msg.Title = "[Test] " + msg.Title
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	if err := h.Notifiers.Send(ctx, rule.Channel, rule.Target, msg); err != nil {
+		utils.WriteError(w, http.StatusBadGateway, "Notification failed: "+err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"value":     result.Value,
+		"baseline":  result.Baseline,
+		"triggered": result.Triggered,
+	})
+}
+
+// GET /projects/{id}/notifications
+func (h *AlertHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Where("project_id = ?", projectID)
+	if r.URL.Query().Get("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC").Limit(100).Find(&notifications).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, notifications)
+}
+
+// POST /projects/{id}/notifications/{notificationId}/read
+func (h *AlertHandler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["notificationId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid notification id")
+		return
+	}
+
+	result := h.DB.Model(&models.Notification{}).
+		Where("id = ? AND project_id = ? AND read_at IS NULL", id, projectID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during update")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AlertHandler) findRule(w http.ResponseWriter, r *http.Request) (models.AlertRule, bool) {
+	var rule models.AlertRule
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return rule, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["alertId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid alert id")
+		return rule, false
+	}
+	if err := h.DB.First(&rule, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Alert rule not found")
+		return rule, false
+	}
+	return rule, true
+}
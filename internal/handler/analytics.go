@@ -2,7 +2,10 @@ package handler
 
 import (
 	"encoding/json"
-	"errors"
+	"jiramo/internal/analytics"
+	"jiramo/internal/geoip"
+	"jiramo/internal/ingest"
+	"jiramo/internal/live"
 	"jiramo/internal/models"
 	"jiramo/internal/utils"
 	"net/http"
@@ -15,27 +18,51 @@ import (
 	"gorm.io/gorm"
 )
 
+const maxEventNameLength = 120
+
 type AnalyticsHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Ingest *ingest.Queue
+	Salts  *utils.SaltRotator
+	Live   *live.Hub
+
+	// Geo is nil when no GeoIP database is configured.
+	Geo *geoip.Reader
 }
 
-func NewAnalyticsHandler(db *gorm.DB) *AnalyticsHandler {
-	return &AnalyticsHandler{db}
+func NewAnalyticsHandler(db *gorm.DB, queue *ingest.Queue, hub *live.Hub) *AnalyticsHandler {
+	h := &AnalyticsHandler{DB: db, Ingest: queue, Live: hub}
+	h.Salts = utils.NewSaltRotator(func() *gorm.DB { return h.DB })
+	return h
 }
 
 type TrackPayload struct {
-	ProjectID     string `json:"project_id"`
-	URL           string `json:"url"`
-	Referrer      string `json:"referrer"`
-	Title         string `json:"title"`
+	ProjectID string `json:"project_id"`
+	URL       string `json:"url"`
+	Referrer  string `json:"referrer"`
+	Title     string `json:"title"`
+
+	// PrevViewID is the view_id returned for the previous page of an SPA;
+	// its duration ends when this page is tracked.
+	PrevViewID string `json:"prev_view_id"`
+	// PrevPath and PrevCreatedAt describe the previous page for trackers
+	// older than view IDs; they are only used without PrevViewID.
 	PrevPath      string `json:"prev_path"`
 	PrevCreatedAt string `json:"prev_created_at"`
 }
 
-type EventPayload struct {
+type LeavePayload struct {
 	ProjectID string `json:"project_id"`
-	URL       string `json:"url"`
-	EventName string `json:"event_name"`
+	ViewID    string `json:"view_id"`
+}
+
+type EventPayload struct {
+	ProjectID string          `json:"project_id"`
+	URL       string          `json:"url"`
+	EventName string          `json:"event_name"`
+	Props     json.RawMessage `json:"props"`
+
+	// EventData is the JSON-encoded properties sent by older trackers.
 	EventData string `json:"event_data"`
 }
 
@@ -53,104 +80,185 @@ func (h *AnalyticsHandler) Track(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+	var project models.Project
+	if err := h.DB.First(&project, "id = ?", projectID).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
+	if project.RespectDNT && utils.DoNotTrack(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if h.filtered(w, r, project) {
+		return
+	}
+
 	parsedURL, err := url.Parse(payload.URL)
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid URL")
 		return
 	}
 
-	visitorID := utils.VisitorFingerprint(r, payload.ProjectID)
-	browser, os, device := utils.ParseUserAgent(r.UserAgent())
-	utmSource, utmMedium, utmCampaign := utils.ParseUTM(r)
-
-	lang := r.Header.Get("Accept-Language")
-	if idx := strings.Index(lang, ","); idx != -1 {
-		lang = lang[:idx]
+	visitorIDs, ok := h.visitorIDs(w, r, payload.ProjectID)
+	if !ok {
+		return
 	}
 
-	var session models.Session
-	sessionErr := h.DB.
-		Where("visitor_id = ? AND project_id = ? AND expires_at > ?",
-			visitorID, projectID, time.Now()).
-		Order("expires_at DESC").
-		First(&session).Error
-
-	isNewSession := errors.Is(sessionErr, gorm.ErrRecordNotFound)
-
-	if isNewSession {
-		session = models.Session{
-			ID:          uuid.New(),
-			ProjectID:   projectID,
-			VisitorID:   visitorID,
-			SessionID:   utils.NewSessionID(visitorID),
-			Hostname:    parsedURL.Hostname(),
-			Browser:     browser,
-			OS:          os,
-			Device:      device,
-			Language:    lang,
-			Referrer:    payload.Referrer,
-			UTMSource:   utmSource,
-			UTMMedium:   utmMedium,
-			UTMCampaign: utmCampaign,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
-			ExpiresAt:   utils.SessionExpiresAt(),
-		}
+	hit, session, isNewSession, err := h.pageViewHit(r, projectID, visitorIDs, parsedURL, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not resolve session")
+		return
+	}
 
-		if err := h.DB.Create(&session).Error; err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, "Could not create session")
-			return
-		}
-	} else {
-		h.DB.Model(&session).Updates(map[string]interface{}{
-			"expires_at": utils.SessionExpiresAt(),
-			"updated_at": time.Now(),
-		})
+	if !h.enqueue(w, hit) {
+		return
 	}
+	h.publishPageView(hit.PageView, session)
 
-	if payload.PrevPath != "" && payload.PrevCreatedAt != "" {
-		if prevTime, err := time.Parse(time.RFC3339, payload.PrevCreatedAt); err == nil {
-			dur := int(time.Since(prevTime).Seconds())
-			if dur > 0 && dur < 3600 {
-				h.DB.Model(&models.PageView{}).
-					Where("session_id = ? AND path = ? AND created_at >= ?",
-						session.SessionID,
-						payload.PrevPath,
-						prevTime.Add(-2*time.Second)).
-					Update("duration", dur)
-			}
-		}
+	utils.WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+		"session_id":  session.SessionID,
+		"view_id":     hit.PageView.ID,
+		"new_session": isNewSession,
+	})
+}
+
+// pageViewHit resolves the visitor's session, starting one when there is
+// none, and builds the hit recording a view of pageURL.
+func (h *AnalyticsHandler) pageViewHit(r *http.Request, projectID uuid.UUID, visitorIDs []string, pageURL *url.URL, payload TrackPayload) (ingest.Hit, models.Session, bool, error) {
+	session, _, isNewSession, err := h.Ingest.Sessions.Resolve(projectID.String(), visitorIDs, func() models.Session {
+		return h.buildSession(r, projectID, visitorIDs[0], pageURL, payload.Referrer)
+	})
+	if err != nil {
+		return ingest.Hit{}, models.Session{}, false, err
 	}
 
 	view := models.PageView{
 		ID:        uuid.New(),
 		ProjectID: projectID,
 		SessionID: session.SessionID,
-		VisitorID: visitorID,
+		VisitorID: session.VisitorID,
 		URL:       payload.URL,
-		Path:      parsedURL.Path,
+		Path:      pageURL.Path,
 		Referrer:  payload.Referrer,
 		Title:     payload.Title,
 		CreatedAt: time.Now(),
 	}
 
-	if err := h.DB.Create(&view).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Could not record page view")
-		return
+	hit := ingest.Hit{PageView: &view}
+	if isNewSession {
+		hit.NewSession = &session
+	} else {
+		hit.TouchSession = session.SessionID
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
-		"session_id":  session.SessionID,
-		"view_id":     view.ID,
-		"new_session": isNewSession,
+	if prevViewID, err := uuid.Parse(payload.PrevViewID); err == nil {
+		hit.ViewDuration = &ingest.ViewDuration{
+			ProjectID: projectID.String(),
+			ViewID:    prevViewID.String(),
+			EndedAt:   view.CreatedAt,
+		}
+	} else if payload.PrevPath != "" && payload.PrevCreatedAt != "" {
+		if prevTime, err := time.Parse(time.RFC3339, payload.PrevCreatedAt); err == nil {
+			dur := int(view.CreatedAt.Sub(prevTime).Seconds())
+			if dur > 0 && dur < 3600 {
+				hit.PathDuration = &ingest.PathDuration{
+					SessionID: session.SessionID,
+					Path:      payload.PrevPath,
+					StartedAt: prevTime,
+					Seconds:   dur,
+				}
+			}
+		}
+	}
+
+	return hit, session, isNewSession, nil
+}
+
+// buildSession starts a session for a visitor landing on pageURL, described
+// by the request's User-Agent, language and location.
+func (h *AnalyticsHandler) buildSession(r *http.Request, projectID uuid.UUID, visitorID string, pageURL *url.URL, referrer string) models.Session {
+	browser, os, device := utils.ParseUserAgent(r.UserAgent())
+	utmSource, utmMedium, utmCampaign := utils.ParseUTM(pageURL)
+
+	lang := r.Header.Get("Accept-Language")
+	if idx := strings.Index(lang, ","); idx != -1 {
+		lang = lang[:idx]
+	}
+
+	// Only the derived location is kept; the IP itself is never stored.
+	location, _ := h.Geo.Lookup(utils.ClientIP(r))
+	return models.Session{
+		ID:          uuid.New(),
+		ProjectID:   projectID,
+		VisitorID:   visitorID,
+		SessionID:   utils.NewSessionID(visitorID),
+		Hostname:    pageURL.Hostname(),
+		Browser:     browser,
+		OS:          os,
+		Device:      device,
+		Country:     location.Country,
+		Region:      location.Region,
+		City:        location.City,
+		Language:    lang,
+		Referrer:    referrer,
+		UTMSource:   utmSource,
+		UTMMedium:   utmMedium,
+		UTMCampaign: utmCampaign,
+		Channel:     utils.ClassifyChannel(referrer, pageURL.Hostname(), utmSource, utmMedium),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		ExpiresAt:   utils.SessionExpiresAt(),
+	}
+}
+
+func (h *AnalyticsHandler) publishPageView(view *models.PageView, session models.Session) {
+	h.Live.Publish(view.ProjectID.String(), live.Hit{
+		Type:      live.HitPageView,
+		VisitorID: view.VisitorID,
+		Path:      view.Path,
+		Title:     view.Title,
+		Referrer:  session.Referrer,
+		Country:   session.Country,
+		Device:    session.Device,
+		Browser:   session.Browser,
+		CreatedAt: view.CreatedAt,
 	})
 }
 
+// POST /analytics/leave
+func (h *AnalyticsHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	var payload LeavePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	projectID, err := uuid.Parse(payload.ProjectID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid project_id")
+		return
+	}
+
+	viewID, err := uuid.Parse(payload.ViewID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid view_id")
+		return
+	}
+
+	hit := ingest.Hit{ViewDuration: &ingest.ViewDuration{
+		ProjectID: projectID.String(),
+		ViewID:    viewID.String(),
+		EndedAt:   time.Now(),
+	}}
+	if !h.enqueue(w, hit) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 // POST /analytics/event
 func (h *AnalyticsHandler) TrackEvent(w http.ResponseWriter, r *http.Request) {
 	var payload EventPayload
@@ -165,89 +273,184 @@ func (h *AnalyticsHandler) TrackEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if strings.TrimSpace(payload.EventName) == "" {
+	if strings.TrimSpace(payload.EventName) == "" || len(payload.EventName) > maxEventNameLength {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid event name")
 		return
 	}
 
+	rawProps := []byte(payload.Props)
+	if len(rawProps) == 0 {
+		rawProps = []byte(payload.EventData)
+	}
+	props, err := analytics.ParseProperties(rawProps)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid props: "+err.Error())
+		return
+	}
+
+	var project models.Project
+	if err := h.DB.First(&project, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	if project.RespectDNT && utils.DoNotTrack(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if h.filtered(w, r, project) {
+		return
+	}
+
 	parsedURL, err := url.Parse(payload.URL)
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid URL")
 		return
 	}
 
-	visitorID := utils.VisitorFingerprint(r, payload.ProjectID)
+	visitorIDs, ok := h.visitorIDs(w, r, payload.ProjectID)
+	if !ok {
+		return
+	}
 
-	var session models.Session
-	sessionErr := h.DB.
-		Where("visitor_id = ? AND project_id = ? AND expires_at > ?",
-			visitorID, projectID, time.Now()).
-		Order("expires_at DESC").
-		First(&session).Error
+	session, found, _, err := h.Ingest.Sessions.Resolve(projectID.String(), visitorIDs, nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not resolve session")
+		return
+	}
 
-	sessionID := ""
-	if errors.Is(sessionErr, gorm.ErrRecordNotFound) {
+	sessionID, visitorID := session.SessionID, session.VisitorID
+	if !found {
+		visitorID = visitorIDs[0]
 		sessionID = utils.NewSessionID(visitorID)
-	} else {
-		sessionID = session.SessionID
 	}
 
 	event := models.AnalyticsEvent{
-		ID:        uuid.New(),
-		ProjectID: projectID,
-		SessionID: sessionID,
-		VisitorID: visitorID,
-		URL:       payload.URL,
-		Path:      parsedURL.Path,
-		EventName: payload.EventName,
-		EventData: payload.EventData,
-		CreatedAt: time.Now(),
+		ID:         uuid.New(),
+		ProjectID:  projectID,
+		SessionID:  sessionID,
+		VisitorID:  visitorID,
+		URL:        payload.URL,
+		Path:       parsedURL.Path,
+		EventName:  payload.EventName,
+		Properties: props,
+		CreatedAt:  time.Now(),
 	}
 
-	if err := h.DB.Create(&event).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Could not record event")
+	hit := ingest.Hit{Event: &event}
+	if found {
+		hit.TouchSession = sessionID
+	}
+	if !h.enqueue(w, hit) {
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, map[string]string{
+	h.publishEvent(&event, session)
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{
 		"event_id": event.ID.String(),
 	})
 }
 
-// GET /projects/{id}/analytics
-func (h *AnalyticsHandler) GetProjectStats(w http.ResponseWriter, r *http.Request) {
-	projectID := mux.Vars(r)["id"]
-	from, to := parseDateRange(r)
+func (h *AnalyticsHandler) publishEvent(event *models.AnalyticsEvent, session models.Session) {
+	h.Live.Publish(event.ProjectID.String(), live.Hit{
+		Type:      live.HitEvent,
+		VisitorID: event.VisitorID,
+		Path:      event.Path,
+		Name:      event.EventName,
+		Country:   session.Country,
+		Device:    session.Device,
+		Browser:   session.Browser,
+		CreatedAt: event.CreatedAt,
+	})
+}
 
-	var totalViews int64
-	h.DB.Model(&models.PageView{}).
-		Where("project_id = ? AND created_at BETWEEN ? AND ?", projectID, from, to).
-		Count(&totalViews)
+// visitorIDs returns the visitor's fingerprint under today's salt followed,
+// when available, by the one under yesterday's salt.
+func (h *AnalyticsHandler) visitorIDs(w http.ResponseWriter, r *http.Request, projectID string) ([]string, bool) {
+	ids, err := h.fingerprints(utils.ClientIP(r), r.UserAgent(), projectID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute visitor id")
+		return nil, false
+	}
+	return ids, true
+}
 
-	var totalVisitors int64
-	h.DB.Model(&models.PageView{}).
-		Where("project_id = ? AND created_at BETWEEN ? AND ?", projectID, from, to).
-		Distinct("visitor_id").
-		Count(&totalVisitors)
+// fingerprints is visitorIDs for a visitor known by IP and User-Agent
+// rather than by the request, e.g. when a server reports on its behalf.
+func (h *AnalyticsHandler) fingerprints(ip, userAgent, projectID string) ([]string, error) {
+	current, previous, err := h.Salts.Salts()
+	if err != nil {
+		return nil, err
+	}
 
-	var totalSessions int64
-	h.DB.Model(&models.Session{}).
-		Where("project_id = ? AND created_at BETWEEN ? AND ?", projectID, from, to).
-		Count(&totalSessions)
+	ids := []string{utils.VisitorFingerprint(ip, userAgent, projectID, current)}
+	if previous != nil {
+		ids = append(ids, utils.VisitorFingerprint(ip, userAgent, projectID, previous))
+	}
+	return ids, nil
+}
 
-	var bounceSessions int64
-	h.DB.Raw(`
-		SELECT COUNT(*) FROM (
-			SELECT session_id FROM page_views
-			WHERE project_id = ? AND created_at BETWEEN ? AND ?
-			GROUP BY session_id
-			HAVING COUNT(*) = 1
-		) sub`, projectID, from, to).Scan(&bounceSessions)
+// filtered answers 204 to tracker requests from bots or excluded IPs and
+// counts them per reason instead of recording a hit.
+func (h *AnalyticsHandler) filtered(w http.ResponseWriter, r *http.Request, project models.Project) bool {
+	if h.filterReason(r, project, utils.DetectTrackerBot(r)) == "" {
+		return false
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// filterReason returns why a request is not tracked, given what bot
+// detection found, or "" when it is. Excluded IPs are checked here, and
+// filtered requests are counted per reason.
+func (h *AnalyticsHandler) filterReason(r *http.Request, project models.Project, reason string) string {
+	if reason == "" && utils.IPExcluded(r, project.ExcludedIPs) {
+		reason = utils.BotExcludedIP
+	}
+	if reason == "" {
+		return ""
+	}
+
+	// Counting is best effort; a full queue only loses the counter update.
+	h.Ingest.Enqueue(ingest.Hit{Filtered: &ingest.Filtered{
+		ProjectID: project.ID,
+		Reason:    reason,
+		At:        time.Now(),
+	}})
+	return reason
+}
+
+// enqueue hands a hit to the ingestion queue, answering 503 when the queue
+// is saturated so clients back off.
+func (h *AnalyticsHandler) enqueue(w http.ResponseWriter, hit ingest.Hit) bool {
+	if err := h.Ingest.Enqueue(hit); err != nil {
+		w.Header().Set("Retry-After", "5")
+		utils.WriteError(w, http.StatusServiceUnavailable, "Tracking temporarily unavailable")
+		return false
+	}
+	return true
+}
+
+// GET /projects/{id}/analytics
+func (h *AnalyticsHandler) GetProjectStats(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	from, to := parseDateRange(r)
+	compare, ok := parseCompare(w, r, from, to)
+	if !ok {
+		return
+	}
 
-	bounceRate := 0.0
-	if totalSessions > 0 {
-		bounceRate = float64(bounceSessions) / float64(totalSessions) * 100
+	totals, err := analytics.ProjectTotals(h.DB, projectID.String(), from, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute stats")
+		return
 	}
+	summary := summaryMetrics(totals)
 
 	type eventStat struct {
 		EventName string `json:"event_name"`
@@ -261,15 +464,43 @@ func (h *AnalyticsHandler) GetProjectStats(w http.ResponseWriter, r *http.Reques
 		GROUP BY event_name ORDER BY count DESC LIMIT 20`,
 		projectID, from, to).Scan(&events)
 
-	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"summary": map[string]interface{}{
-			"visitors":    totalVisitors,
-			"visits":      totalSessions,
-			"views":       totalViews,
-			"bounce_rate": bounceRate,
-		},
-		"events": events,
-	})
+	response := map[string]interface{}{
+		"summary": summary,
+		"events":  events,
+		"note":    visitorsNote,
+	}
+
+	if compare != nil {
+		previous, err := analytics.ProjectTotals(h.DB, projectID.String(), compare.From, compare.To)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Could not compute stats")
+			return
+		}
+		previousSummary := summaryMetrics(previous)
+		response["comparison"] = map[string]interface{}{
+			"mode":    compare.Mode,
+			"from":    compare.From,
+			"to":      compare.To,
+			"summary": previousSummary,
+			"change":  metricChanges(summary, previousSummary),
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// visitorsNote explains the visitors total: visitor IDs change with the
+// daily salt, so each day's unique visitors are summed.
+const visitorsNote = "Visitors are counted per day and summed over the range; a visitor active on several days counts once per day."
+
+func summaryMetrics(totals analytics.Totals) map[string]float64 {
+	return map[string]float64{
+		"visitors":           float64(totals.Visitors),
+		"visits":             float64(totals.Sessions),
+		"views":              float64(totals.Views),
+		"bounce_rate":        totals.BounceRate(),
+		"avg_visit_duration": totals.AvgDuration(),
+	}
 }
 
 // GET /projects/{id}/analytics/realtime
@@ -295,6 +526,12 @@ func (h *AnalyticsHandler) GetRealtimeStats(w http.ResponseWriter, r *http.Reque
 }
 
 func parseDateRange(r *http.Request) (from, to time.Time) {
+	return parseDateRangeIn(r, time.UTC)
+}
+
+// parseDateRangeIn is parseDateRange with date-only values interpreted as
+// midnight in loc rather than UTC.
+func parseDateRangeIn(r *http.Request, loc *time.Location) (from, to time.Time) {
 	to = time.Now()
 	from = to.AddDate(0, 0, -30)
 
@@ -302,7 +539,7 @@ func parseDateRange(r *http.Request) (from, to time.Time) {
 
 	if s := r.URL.Query().Get("from"); s != "" {
 		for _, l := range layouts {
-			if t, err := time.Parse(l, s); err == nil {
+			if t, err := time.ParseInLocation(l, s, loc); err == nil {
 				from = t
 				break
 			}
@@ -311,7 +548,7 @@ func parseDateRange(r *http.Request) (from, to time.Time) {
 
 	if s := r.URL.Query().Get("to"); s != "" {
 		for _, l := range layouts {
-			if t, err := time.Parse(l, s); err == nil {
+			if t, err := time.ParseInLocation(l, s, loc); err == nil {
 				to = t.Add(24*time.Hour - time.Second)
 				break
 			}
@@ -320,3 +557,27 @@ func parseDateRange(r *http.Request) (from, to time.Time) {
 
 	return
 }
+
+func projectIDFromRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	projectID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid project id")
+		return uuid.Nil, false
+	}
+	return projectID, true
+}
+
+// locationFromRequest reads the IANA time zone from the tz query parameter,
+// defaulting to UTC.
+func locationFromRequest(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid tz")
+		return nil, false
+	}
+	return loc, true
+}
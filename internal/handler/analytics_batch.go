@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"jiramo/internal/analytics"
+	"jiramo/internal/ingest"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxBatchItems = 100
+
+	// MaxBatchBody caps the body of a batch: every item may carry the
+	// largest properties allowed, plus room for its URL, title and
+	// referrer.
+	MaxBatchBody = maxBatchItems * (analytics.MaxPropertiesSize + 4096)
+
+	// maxBatchAge bounds how long a client may buffer hits before sending
+	// them, and maxClockSkew how far ahead of the server its clock may run.
+	maxBatchAge  = 72 * time.Hour
+	maxClockSkew = 5 * time.Minute
+)
+
+const (
+	batchPageView = "pageview"
+	batchEvent    = "event"
+
+	// batchDoNotTrack is the error of the items of a batch dropped because
+	// of Do Not Track; other filtered batches carry the bot filter reason.
+	batchDoNotTrack = "do_not_track"
+)
+
+type BatchPayload struct {
+	ProjectID string `json:"project_id"`
+	// Items are decoded one by one so that a malformed item only rejects
+	// itself.
+	Items []json.RawMessage `json:"items"`
+}
+
+type BatchItem struct {
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	URL       string `json:"url"`
+	Referrer  string `json:"referrer"`
+	Title     string `json:"title"`
+
+	EventName string          `json:"event_name"`
+	Props     json.RawMessage `json:"props"`
+}
+
+type batchResult struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"`
+	ID        string `json:"id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// batchEntry is a batch item that passed validation.
+type batchEntry struct {
+	index int
+	item  BatchItem
+	at    time.Time
+	url   *url.URL
+	props models.Properties
+}
+
+// POST /analytics/batch
+//
+// Records page views and events buffered by a client, such as a mobile app
+// that was offline, each dated by the client. Items are validated one by
+// one and the response reports each as accepted or rejected; the accepted
+// ones are stored in a single transaction.
+//
+// Items are replayed in time order: page views more than a session timeout
+// apart start new sessions, and consecutive page views get their duration.
+func (h *AnalyticsHandler) TrackBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBatchBody)
+	var payload BatchPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, "Payload too large")
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	projectID, err := uuid.Parse(payload.ProjectID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid project_id")
+		return
+	}
+
+	if len(payload.Items) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "No items")
+		return
+	}
+	if len(payload.Items) > maxBatchItems {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, "Too many items")
+		return
+	}
+
+	var project models.Project
+	if err := h.DB.First(&project, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	now := time.Now()
+	results := make([]batchResult, len(payload.Items))
+
+	// A filtered batch is answered like any other, so that clients drop the
+	// items instead of retrying them.
+	var reason string
+	if project.RespectDNT && utils.DoNotTrack(r) {
+		reason = batchDoNotTrack
+	} else {
+		reason = h.filterReason(r, project, utils.DetectBot(r))
+	}
+	if reason != "" {
+		for i := range results {
+			results[i] = batchResult{Index: i, Status: "rejected", Error: reason}
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"accepted": 0,
+			"rejected": len(results),
+			"results":  results,
+		})
+		return
+	}
+
+	var entries []batchEntry
+	for i, raw := range payload.Items {
+		results[i].Index = i
+		entry, reason := parseBatchItem(raw, now)
+		if reason != "" {
+			results[i].Status = "rejected"
+			results[i].Error = reason
+			continue
+		}
+		entry.index = i
+		entries = append(entries, entry)
+	}
+
+	if len(entries) > 0 {
+		visitorIDs, ok := h.visitorIDs(w, r, payload.ProjectID)
+		if !ok {
+			return
+		}
+
+		hits, err := h.batchHits(r, projectID, visitorIDs, entries, results, now)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Could not resolve session")
+			return
+		}
+
+		if err := h.Ingest.Write(hits); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Could not store batch")
+			return
+		}
+
+		// Entries are sorted, so the first one is the oldest.
+		if err := analytics.Rewind(h.DB, projectID, entries[0].at); err != nil {
+			log.Printf("batch: could not rewind rollups: %v", err)
+		}
+	}
+
+	accepted := len(entries)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"accepted": accepted,
+		"rejected": len(payload.Items) - accepted,
+		"results":  results,
+	})
+}
+
+// parseBatchItem validates an item, returning why it is rejected if it is.
+func parseBatchItem(raw json.RawMessage, now time.Time) (batchEntry, string) {
+	var entry batchEntry
+	if err := json.Unmarshal(raw, &entry.item); err != nil {
+		return entry, "Invalid item"
+	}
+	item := entry.item
+
+	if item.Timestamp == "" {
+		return entry, "Missing timestamp"
+	}
+	at, err := time.Parse(time.RFC3339, item.Timestamp)
+	if err != nil {
+		return entry, "Invalid timestamp"
+	}
+	if at.After(now.Add(maxClockSkew)) {
+		return entry, "Timestamp is in the future"
+	}
+	if at.Before(now.Add(-maxBatchAge)) {
+		return entry, "Timestamp is too old"
+	}
+	// A clock slightly ahead still must not date hits after the server.
+	if at.After(now) {
+		at = now
+	}
+	entry.at = at
+
+	entry.url, err = url.Parse(item.URL)
+	if err != nil {
+		return entry, "Invalid URL"
+	}
+
+	switch item.Type {
+	case batchPageView:
+	case batchEvent:
+		if strings.TrimSpace(item.EventName) == "" || len(item.EventName) > maxEventNameLength {
+			return entry, "Invalid event name"
+		}
+		entry.props, err = analytics.ParseProperties(item.Props)
+		if err != nil {
+			return entry, "Invalid props: " + err.Error()
+		}
+	default:
+		return entry, "Unknown type, expected pageview or event"
+	}
+	return entry, ""
+}
+
+// batchHits assigns the entries to sessions and builds their hits, filling
+// in the result of each. Entries join the visitor's active session when
+// they are recent enough, or the session started by an earlier page view of
+// the batch; like single events, an event outside any session gets a
+// session id of its own.
+func (h *AnalyticsHandler) batchHits(r *http.Request, projectID uuid.UUID, visitorIDs []string, entries []batchEntry, results []batchResult, now time.Time) ([]ingest.Hit, error) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].at.Before(entries[j].at)
+	})
+
+	active, hasActive, _, err := h.Ingest.Sessions.Resolve(projectID.String(), visitorIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		hits     []ingest.Hit
+		current  *models.Session
+		lastView *models.PageView
+	)
+	for _, entry := range entries {
+		var hit ingest.Hit
+
+		var session *models.Session
+		switch {
+		case hasActive && now.Sub(entry.at) <= utils.SessionTTL:
+			session = &active
+			hit.TouchSession = active.SessionID
+		case current != nil && entry.at.Sub(current.UpdatedAt) <= utils.SessionTTL:
+			session = current
+			session.UpdatedAt = entry.at
+			session.ExpiresAt = entry.at.Add(utils.SessionTTL)
+		case entry.item.Type == batchPageView:
+			started := h.buildSession(r, projectID, visitorIDs[0], entry.url, entry.item.Referrer)
+			started.CreatedAt = entry.at
+			started.UpdatedAt = entry.at
+			started.ExpiresAt = entry.at.Add(utils.SessionTTL)
+			current, session = &started, &started
+			hit.NewSession = &started
+		}
+
+		sessionID, visitorID := utils.NewSessionID(visitorIDs[0]), visitorIDs[0]
+		if session != nil {
+			sessionID, visitorID = session.SessionID, session.VisitorID
+		}
+
+		var id uuid.UUID
+		switch entry.item.Type {
+		case batchPageView:
+			view := models.PageView{
+				ID:        uuid.New(),
+				ProjectID: projectID,
+				SessionID: sessionID,
+				VisitorID: visitorID,
+				URL:       entry.item.URL,
+				Path:      entry.url.Path,
+				Referrer:  entry.item.Referrer,
+				Title:     entry.item.Title,
+				CreatedAt: entry.at,
+			}
+			if lastView != nil && lastView.SessionID == sessionID {
+				lastView.Duration = int(entry.at.Sub(lastView.CreatedAt).Seconds())
+			}
+			lastView = &view
+			hit.PageView = &view
+			id = view.ID
+		case batchEvent:
+			event := models.AnalyticsEvent{
+				ID:         uuid.New(),
+				ProjectID:  projectID,
+				SessionID:  sessionID,
+				VisitorID:  visitorID,
+				URL:        entry.item.URL,
+				Path:       entry.url.Path,
+				EventName:  entry.item.EventName,
+				Properties: entry.props,
+				CreatedAt:  entry.at,
+			}
+			hit.Event = &event
+			id = event.ID
+		}
+
+		hits = append(hits, hit)
+		results[entry.index] = batchResult{
+			Index:     entry.index,
+			Status:    "accepted",
+			ID:        id.String(),
+			SessionID: sessionID,
+		}
+	}
+	return hits, nil
+}
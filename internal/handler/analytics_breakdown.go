@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"fmt"
+	"jiramo/internal/analytics"
+	"jiramo/internal/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type breakdownRow struct {
+	analytics.BreakdownRow
+
+	Previous *breakdownRow       `json:"previous,omitempty"`
+	Change   map[string]*float64 `json:"change,omitempty"`
+}
+
+func (r breakdownRow) metrics() map[string]float64 {
+	return map[string]float64{
+		"visitors":     float64(r.Visitors),
+		"views":        float64(r.Views),
+		"sessions":     float64(r.Sessions),
+		"bounce_rate":  r.BounceRate,
+		"avg_duration": r.AvgDuration,
+	}
+}
+
+// GET /projects/{id}/analytics/breakdown/{dimension}
+func (h *AnalyticsHandler) GetBreakdown(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	dimension := mux.Vars(r)["dimension"]
+	if _, ok := analytics.Dimensions[dimension]; !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Unknown dimension")
+		return
+	}
+
+	filters, err := parseDimensionFilters(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, limit := parsePagination(r, 10, 100)
+	from, to := parseDateRange(r)
+	compare, ok := parseCompare(w, r, from, to)
+	if !ok {
+		return
+	}
+
+	q := analytics.BreakdownQuery{
+		Dimension: dimension,
+		Filters:   filters,
+		Search:    strings.TrimSpace(r.URL.Query().Get("search")),
+		Limit:     limit,
+		Offset:    (page - 1) * limit,
+	}
+
+	rows, partial, err := h.breakdown(projectID.String(), from, to, q)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute breakdown")
+		return
+	}
+
+	total, err := analytics.CountBreakdown(h.DB, projectID.String(), from, to, q)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute breakdown")
+		return
+	}
+
+	response := map[string]interface{}{
+		"dimension": dimension,
+		"filters":   filters,
+		"page":      page,
+		"limit":     limit,
+		"total":     total,
+		"results":   rows,
+	}
+
+	if compare != nil {
+		prevPartial, err := h.compareBreakdown(projectID.String(), compare, q, rows)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Could not compute breakdown")
+			return
+		}
+		partial = partial || prevPartial
+		response["comparison"] = compare
+	}
+	response["partial"] = partial
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// breakdown is analytics.Breakdown with rows that can carry a comparison.
+func (h *AnalyticsHandler) breakdown(projectID string, from, to time.Time, q analytics.BreakdownQuery) ([]breakdownRow, bool, error) {
+	results, partial, err := analytics.Breakdown(h.DB, projectID, from, to, q)
+	if err != nil {
+		return nil, false, err
+	}
+	rows := make([]breakdownRow, len(results))
+	for i, result := range results {
+		rows[i].BreakdownRow = result
+	}
+	return rows, partial, nil
+}
+
+// compareBreakdown fills in the previous values of rows, computing the
+// breakdown of the compared window for the same dimension values only. It
+// reports whether the previous values may be partial.
+func (h *AnalyticsHandler) compareBreakdown(projectID string, compare *comparison, q analytics.BreakdownQuery, rows []breakdownRow) (bool, error) {
+	if len(rows) == 0 {
+		return false, nil
+	}
+
+	prevQuery := analytics.BreakdownQuery{Dimension: q.Dimension, Filters: q.Filters, Limit: len(rows)}
+	for _, row := range rows {
+		prevQuery.Values = append(prevQuery.Values, row.Value)
+	}
+	previous, partial, err := h.breakdown(projectID, compare.From, compare.To, prevQuery)
+	if err != nil {
+		return false, err
+	}
+
+	byValue := make(map[string]breakdownRow, len(previous))
+	for _, row := range previous {
+		byValue[row.Value] = row
+	}
+	for i := range rows {
+		prev := byValue[rows[i].Value]
+		prev.Value = rows[i].Value
+		rows[i].Previous = &prev
+		rows[i].Change = metricChanges(rows[i].metrics(), prev.metrics())
+	}
+	return partial, nil
+}
+
+// parseDimensionFilters reads filter[<dimension>]=<value> query parameters.
+func parseDimensionFilters(r *http.Request) (map[string]string, error) {
+	filters := map[string]string{}
+	for key, values := range r.URL.Query() {
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		dimension := key[len("filter[") : len(key)-1]
+		if _, ok := analytics.Dimensions[dimension]; !ok {
+			return nil, fmt.Errorf("Unknown filter dimension %q", dimension)
+		}
+		if len(values) > 0 {
+			filters[dimension] = values[0]
+		}
+	}
+	return filters, nil
+}
+
+func parsePagination(r *http.Request, defaultLimit, maxLimit int) (page, limit int) {
+	page, limit = 1, defaultLimit
+
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return
+}
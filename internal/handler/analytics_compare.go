@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"jiramo/internal/utils"
+	"net/http"
+	"time"
+)
+
+const (
+	comparePreviousPeriod = "previous_period"
+	comparePreviousYear   = "previous_year"
+)
+
+// comparison describes the window a report is compared against.
+type comparison struct {
+	Mode string    `json:"mode"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// parseCompare reads compare=previous_period|previous_year and shifts
+// [from, to] back accordingly: by its own length, or by one year. It
+// returns nil when no comparison was requested.
+func parseCompare(w http.ResponseWriter, r *http.Request, from, to time.Time) (*comparison, bool) {
+	switch mode := r.URL.Query().Get("compare"); mode {
+	case "":
+		return nil, true
+	case comparePreviousPeriod:
+		span := to.Sub(from) + time.Second
+		return &comparison{Mode: mode, From: from.Add(-span), To: to.Add(-span)}, true
+	case comparePreviousYear:
+		return &comparison{Mode: mode, From: from.AddDate(-1, 0, 0), To: to.AddDate(-1, 0, 0)}, true
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid compare, expected previous_period or previous_year")
+		return nil, false
+	}
+}
+
+// percentChange is the relative change from previous to current in
+// percent, or nil when there is nothing to compare against.
+func percentChange(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := (current - previous) / previous * 100
+	return &change
+}
+
+// metricChanges applies percentChange to every metric of current.
+func metricChanges(current, previous map[string]float64) map[string]*float64 {
+	changes := make(map[string]*float64, len(current))
+	for name, value := range current {
+		changes[name] = percentChange(value, previous[name])
+	}
+	return changes
+}
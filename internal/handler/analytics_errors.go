@@ -0,0 +1,375 @@
+package handler
+
+import (
+	"encoding/json"
+	"jiramo/internal/analytics"
+	"jiramo/internal/ingest"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const maxReleaseLength = 64
+
+type ErrorPayload struct {
+	ProjectID string `json:"project_id"`
+	ViewID    string `json:"view_id"`
+	URL       string `json:"url"`
+	Message   string `json:"message"`
+	Stack     string `json:"stack"`
+	Release   string `json:"release"`
+	// UserAgent overrides the request's User-Agent, for errors relayed by
+	// a server.
+	UserAgent string `json:"user_agent"`
+}
+
+type UpdateErrorGroupInput struct {
+	Status models.ErrorStatus `json:"status"`
+}
+
+type errorGroupRow struct {
+	models.ErrorGroup
+	// Occurrences counts the group's errors within the date range.
+	Occurrences int64 `json:"occurrences"`
+}
+
+// POST /analytics/error
+func (h *AnalyticsHandler) TrackError(w http.ResponseWriter, r *http.Request) {
+	var payload ErrorPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	projectID, err := uuid.Parse(payload.ProjectID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid project_id")
+		return
+	}
+
+	message := strings.TrimSpace(payload.Message)
+	if message == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid message")
+		return
+	}
+	if len(payload.Release) > maxReleaseLength {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid release")
+		return
+	}
+
+	var viewID *uuid.UUID
+	if payload.ViewID != "" {
+		id, err := uuid.Parse(payload.ViewID)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid view_id")
+			return
+		}
+		viewID = &id
+	}
+
+	var project models.Project
+	if err := h.DB.First(&project, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	if project.RespectDNT && utils.DoNotTrack(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if h.filtered(w, r, project) {
+		return
+	}
+
+	parsedURL, err := url.Parse(payload.URL)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid URL")
+		return
+	}
+
+	visitorIDs, ok := h.visitorIDs(w, r, payload.ProjectID)
+	if !ok {
+		return
+	}
+
+	session, found, _, err := h.Ingest.Sessions.Resolve(projectID.String(), visitorIDs, nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not resolve session")
+		return
+	}
+
+	sessionID, visitorID := session.SessionID, session.VisitorID
+	if !found {
+		visitorID = visitorIDs[0]
+		sessionID = utils.NewSessionID(visitorID)
+	}
+
+	userAgent := payload.UserAgent
+	if userAgent == "" {
+		userAgent = r.UserAgent()
+	}
+	browser, os, device := utils.ParseUserAgent(userAgent)
+
+	message = truncate(message, analytics.MaxErrorMessageLength)
+	stack := truncate(payload.Stack, analytics.MaxErrorStackLength)
+	fingerprint, culprit := analytics.ErrorFingerprint(message, stack)
+
+	hit := ingest.Hit{Error: &ingest.ErrorHit{
+		Occurrence: models.ErrorOccurrence{
+			ID:          uuid.New(),
+			ProjectID:   projectID,
+			Fingerprint: fingerprint,
+			SessionID:   sessionID,
+			VisitorID:   visitorID,
+			ViewID:      viewID,
+			URL:         payload.URL,
+			Path:        parsedURL.Path,
+			Message:     message,
+			Stack:       stack,
+			Release:     payload.Release,
+			Browser:     browser,
+			OS:          os,
+			Device:      device,
+			CreatedAt:   time.Now(),
+		},
+		Type:    analytics.ErrorType(message),
+		Culprit: culprit,
+	}}
+	if !h.enqueue(w, hit) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GET /projects/{id}/analytics/errors
+//
+// Lists the error groups seen in the date range, by default the unresolved
+// ones, most recent first. status= selects resolved, ignored or all groups;
+// sort= orders by count or sessions instead.
+func (h *AnalyticsHandler) GetErrors(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	page, limit := parsePagination(r, 20, 100)
+	from, to := parseDateRange(r)
+
+	args := map[string]interface{}{
+		"project": projectID,
+		"from":    from,
+		"to":      to,
+		"limit":   limit,
+		"offset":  (page - 1) * limit,
+	}
+	where := ""
+
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+		where += " AND g.status = @status"
+		args["status"] = models.ErrorUnresolved
+	case "all":
+	case string(models.ErrorUnresolved), string(models.ErrorResolved), string(models.ErrorIgnored):
+		where += " AND g.status = @status"
+		args["status"] = status
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	if release := r.URL.Query().Get("release"); release != "" {
+		where += " AND EXISTS (SELECT 1 FROM error_occurrences o WHERE o.group_id = g.id AND o.release = @release)"
+		args["release"] = release
+	}
+
+	order := "g.last_seen_at DESC"
+	switch r.URL.Query().Get("sort") {
+	case "", "last_seen":
+	case "count":
+		order = "g.count DESC"
+	case "sessions":
+		order = "g.sessions DESC"
+	case "first_seen":
+		order = "g.first_seen_at DESC"
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid sort")
+		return
+	}
+
+	var groups []errorGroupRow
+	err := h.DB.Raw(`
+		SELECT g.*,
+			(SELECT COUNT(*) FROM error_occurrences o
+				WHERE o.group_id = g.id AND o.created_at BETWEEN @from AND @to) AS occurrences
+		FROM error_groups g
+		WHERE g.project_id = @project AND g.last_seen_at >= @from AND g.first_seen_at <= @to`+where+`
+		ORDER BY `+order+`, g.id
+		LIMIT @limit OFFSET @offset`, args).Scan(&groups).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve errors")
+		return
+	}
+
+	var total int64
+	err = h.DB.Raw(`
+		SELECT COUNT(*)
+		FROM error_groups g
+		WHERE g.project_id = @project AND g.last_seen_at >= @from AND g.first_seen_at <= @to`+where, args).Scan(&total).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve errors")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"results": groups,
+	})
+}
+
+// GET /projects/{id}/analytics/errors/{errorId}
+//
+// Returns an error group with its daily occurrences in the date range, the
+// browsers and releases it was seen with, and its latest occurrences. Each
+// occurrence carries the session_id to open the visitor's journey.
+func (h *AnalyticsHandler) GetError(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.findErrorGroup(w, r)
+	if !ok {
+		return
+	}
+	from, to := parseDateRange(r)
+
+	type bucket struct {
+		Day   time.Time `json:"day"`
+		Count int64     `json:"count"`
+	}
+	var daily []bucket
+	err := h.DB.Raw(`
+		SELECT date_trunc('day', created_at) AS day, COUNT(*) AS count
+		FROM error_occurrences
+		WHERE group_id = ? AND created_at BETWEEN ? AND ?
+		GROUP BY 1 ORDER BY 1`,
+		group.ID, from, to).Scan(&daily).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve occurrences")
+		return
+	}
+
+	type share struct {
+		Value string `json:"value"`
+		Count int64  `json:"count"`
+	}
+	breakdown := func(column string) ([]share, error) {
+		var rows []share
+		err := h.DB.Raw(`
+			SELECT COALESCE(`+column+`, '') AS value, COUNT(*) AS count
+			FROM error_occurrences
+			WHERE group_id = ? AND created_at BETWEEN ? AND ?
+			GROUP BY 1 ORDER BY count DESC, value LIMIT 10`,
+			group.ID, from, to).Scan(&rows).Error
+		return rows, err
+	}
+	browsers, err := breakdown("browser")
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve occurrences")
+		return
+	}
+	releases, err := breakdown("release")
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve occurrences")
+		return
+	}
+
+	var occurrences []models.ErrorOccurrence
+	err = h.DB.Where("group_id = ?", group.ID).Order("created_at DESC").Limit(20).Find(&occurrences).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve occurrences")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"error":       group,
+		"daily":       daily,
+		"browsers":    browsers,
+		"releases":    releases,
+		"occurrences": occurrences,
+	})
+}
+
+// PATCH /projects/{id}/analytics/errors/{errorId}
+func (h *AnalyticsHandler) UpdateError(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.findErrorGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var input UpdateErrorGroupInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	switch input.Status {
+	case models.ErrorUnresolved, models.ErrorResolved, models.ErrorIgnored:
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	group.Status = input.Status
+	group.ResolvedAt = nil
+	if input.Status == models.ErrorResolved {
+		now := time.Now()
+		group.ResolvedAt = &now
+	}
+
+	err := h.DB.Model(&models.ErrorGroup{}).Where("id = ?", group.ID).Updates(map[string]interface{}{
+		"status":      group.Status,
+		"resolved_at": group.ResolvedAt,
+	}).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during update")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, group)
+}
+
+func (h *AnalyticsHandler) findErrorGroup(w http.ResponseWriter, r *http.Request) (models.ErrorGroup, bool) {
+	var group models.ErrorGroup
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return group, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["errorId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid error id")
+		return group, false
+	}
+	if err := h.DB.First(&group, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Error not found")
+		return group, false
+	}
+	return group, true
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
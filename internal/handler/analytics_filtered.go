@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"jiramo/internal/utils"
+	"net/http"
+)
+
+type filteredCount struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// GET /projects/{id}/analytics/filtered
+func (h *AnalyticsHandler) GetFilteredHits(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	from, to := parseDateRange(r)
+
+	var counts []filteredCount
+	err := h.DB.Raw(`
+		SELECT reason, SUM(count) AS count
+		FROM filtered_hits
+		WHERE project_id = ? AND day BETWEEN CAST(? AS date) AND CAST(? AS date)
+		GROUP BY reason
+		ORDER BY count DESC`,
+		projectID, from.UTC(), to.UTC()).Scan(&counts).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve filtered hits")
+		return
+	}
+
+	var total int64
+	for _, c := range counts {
+		total += c.Count
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"total":   total,
+		"reasons": counts,
+	})
+}
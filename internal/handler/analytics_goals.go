@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"jiramo/internal/analytics"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type funnelStepResult struct {
+	Position       int     `json:"position"`
+	Name           string  `json:"name"`
+	Visitors       int64   `json:"visitors"`
+	ConversionRate float64 `json:"conversion_rate"`
+	DropOff        int64   `json:"drop_off"`
+	DropOffRate    float64 `json:"drop_off_rate"`
+}
+
+// GET /projects/{id}/analytics/goals
+func (h *AnalyticsHandler) GetGoalConversions(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	from, to := parseDateRange(r)
+
+	var goals []models.Goal
+	if err := h.DB.Where("project_id = ?", projectID).Order("created_at").Find(&goals).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve goals")
+		return
+	}
+
+	results, err := analytics.GoalConversions(h.DB, projectID, goals, from, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute goal conversions")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"goals": results,
+	})
+}
+
+// GET /projects/{id}/analytics/funnels/{funnelId}
+func (h *AnalyticsHandler) GetFunnelReport(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	funnelID, err := uuid.Parse(mux.Vars(r)["funnelId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid funnel id")
+		return
+	}
+	from, to := parseDateRange(r)
+
+	var funnel models.Funnel
+	err = h.DB.
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		First(&funnel, "id = ? AND project_id = ?", funnelID, projectID).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Funnel not found")
+		return
+	}
+
+	steps, err := h.funnelSteps(projectID, funnel, from, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute funnel")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"funnel": funnel,
+		"steps":  steps,
+	})
+}
+
+// funnelSteps streams every hit matching any step and walks them per
+// visitor in time order, advancing through the funnel while consecutive
+// steps stay within the funnel's MaxStepInterval. Visitor IDs rotate daily,
+// so a funnel only converts within a UTC day.
+func (h *AnalyticsHandler) funnelSteps(projectID uuid.UUID, funnel models.Funnel, from, to time.Time) ([]funnelStepResult, error) {
+	if len(funnel.Steps) == 0 {
+		return []funnelStepResult{}, nil
+	}
+
+	var parts []string
+	var args []interface{}
+	for i, step := range funnel.Steps {
+		table, cond, arg := analytics.GoalMatch(step.Type, step.PathPattern, step.EventName)
+		parts = append(parts, `SELECT visitor_id, created_at, `+strconv.Itoa(i)+` AS step FROM `+table+`
+			WHERE project_id = ? AND created_at BETWEEN ? AND ? AND `+cond)
+		args = append(args, projectID, from, to, arg)
+	}
+
+	rows, err := h.DB.Raw(strings.Join(parts, " UNION ALL ")+" ORDER BY visitor_id, created_at, step", args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	maxGap := time.Duration(funnel.MaxStepInterval) * time.Second
+	reached := make([]int64, len(funnel.Steps))
+
+	// The state of the visitor being walked; best is added to reached once
+	// the next visitor starts.
+	var (
+		visitor    string
+		next, best int
+		last       time.Time
+	)
+	finish := func() {
+		for s := 0; s < best; s++ {
+			reached[s]++
+		}
+	}
+
+	for rows.Next() {
+		var (
+			visitorID string
+			createdAt time.Time
+			step      int
+		)
+		if err := rows.Scan(&visitorID, &createdAt, &step); err != nil {
+			return nil, err
+		}
+		if visitorID != visitor {
+			finish()
+			visitor, next, best = visitorID, 0, 0
+		}
+
+		if next > 0 && maxGap > 0 && createdAt.Sub(last) > maxGap {
+			next = 0
+		}
+		switch {
+		case next < len(funnel.Steps) && step == next:
+			next++
+			last = createdAt
+		case next == 1 && step == 0:
+			// A later entry into the funnel leaves more time for step two.
+			last = createdAt
+		}
+		if next > best {
+			best = next
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+
+	results := make([]funnelStepResult, len(funnel.Steps))
+	for i, step := range funnel.Steps {
+		res := funnelStepResult{
+			Position: step.Position,
+			Name:     step.Name,
+			Visitors: reached[i],
+		}
+		if reached[0] > 0 {
+			res.ConversionRate = float64(reached[i]) / float64(reached[0]) * 100
+		}
+		if i > 0 {
+			res.DropOff = reached[i-1] - reached[i]
+			if reached[i-1] > 0 {
+				res.DropOffRate = float64(res.DropOff) / float64(reached[i-1]) * 100
+			}
+		}
+		results[i] = res
+	}
+	return results, nil
+}
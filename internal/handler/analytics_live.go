@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"jiramo/internal/live"
+	"jiramo/internal/utils"
+	"net/http"
+	"time"
+)
+
+const liveKeepAlive = 25 * time.Second
+
+// GET /projects/{id}/analytics/live
+//
+// Streams Server-Sent Events: "stats" with the active visitors and the
+// pages they are on, sent on connect and then periodically, and
+// "pageview" and "event" as hits are tracked.
+func (h *AnalyticsHandler) GetLive(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id := projectID.String()
+
+	var seed []live.Presence
+	err := h.DB.Raw(`
+		SELECT DISTINCT ON (visitor_id) visitor_id, path, created_at AS seen
+		FROM page_views
+		WHERE project_id = ? AND created_at >= ?
+		ORDER BY visitor_id, created_at DESC`,
+		projectID, time.Now().Add(-live.ActiveWindow)).Scan(&seed).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not load active visitors")
+		return
+	}
+	h.Live.Seed(id, seed)
+
+	sub := h.Live.Subscribe(id)
+	if sub == nil {
+		utils.WriteError(w, http.StatusServiceUnavailable, "Live stream unavailable")
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeSSE(w, rc, live.Message{Event: "stats", Data: h.Live.Stats(id)}); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, rc, msg); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, rc *http.ResponseController, msg live.Message) error {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Event, data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
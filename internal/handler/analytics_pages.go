@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"jiramo/internal/analytics"
+	"jiramo/internal/utils"
+	"net/http"
+	"time"
+)
+
+type entryPageRow struct {
+	Page        string  `json:"page"`
+	Entries     int64   `json:"entries"`
+	Visitors    int64   `json:"visitors"`
+	BounceRate  float64 `json:"bounce_rate"`
+	AvgDuration float64 `json:"avg_duration"`
+}
+
+type exitPageRow struct {
+	Page     string  `json:"page"`
+	Exits    int64   `json:"exits"`
+	Visitors int64   `json:"visitors"`
+	Views    int64   `json:"views"`
+	ExitRate float64 `json:"exit_rate"`
+}
+
+// GET /projects/{id}/analytics/entry-pages
+//
+// Ranks the first page of each session. Bounce rate and average duration
+// describe the sessions that started on the page. Finalized days are read
+// from the entry page rollups, so visitors are summed per day.
+func (h *AnalyticsHandler) GetEntryPages(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	page, limit := parsePagination(r, 10, 100)
+	from, to := parseDateRange(r)
+
+	args := pageReportArgs(projectID.String(), analytics.EntryPageDimension, page, limit)
+	span, partial, err := h.pageReportSpan(projectID.String(), analytics.EntryPageDimension, from, to, page, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute entry pages")
+		return
+	}
+	parts := span.SQL(args, rolledPagesSQL,
+		func(within func(string) string) string {
+			return `
+		SELECT f.path AS value,
+			COUNT(*) AS sessions,
+			COUNT(DISTINCT f.visitor_id) AS visitors,
+			SUM(sess.views) AS views,
+			COUNT(*) FILTER (WHERE sess.views = 1) AS bounces,
+			SUM(sess.duration) AS duration
+		FROM (
+			SELECT DISTINCT ON (session_id) session_id, visitor_id, path
+			FROM page_views
+			WHERE project_id = @project AND ` + within("created_at") + `
+			ORDER BY session_id, created_at
+		) f
+		JOIN (
+			SELECT session_id, COUNT(*) AS views, COALESCE(SUM(duration), 0) AS duration
+			FROM page_views
+			WHERE project_id = @project AND ` + within("created_at") + `
+			GROUP BY session_id
+		) sess ON sess.session_id = f.session_id
+		GROUP BY f.path`
+		})
+
+	var rows []entryPageRow
+	err = h.DB.Raw(`
+		SELECT value AS page,
+			SUM(sessions) AS entries,
+			SUM(visitors) AS visitors,
+			COALESCE(SUM(bounces) * 100.0 / NULLIF(SUM(sessions), 0), 0) AS bounce_rate,
+			COALESCE(SUM(duration) * 1.0 / NULLIF(SUM(sessions), 0), 0) AS avg_duration
+		FROM (`+parts+`
+		) parts
+		GROUP BY value
+		ORDER BY entries DESC, page
+		LIMIT @limit OFFSET @offset`, args).Scan(&rows).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute entry pages")
+		return
+	}
+
+	total, err := h.countPageValues(parts, args)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute entry pages")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"partial": partial,
+		"results": rows,
+	})
+}
+
+// GET /projects/{id}/analytics/exit-pages
+//
+// Ranks the last page of each session. The exit rate is the share of the
+// page's views that ended a session. Finalized days are read from the exit
+// page rollups, so visitors are summed per day.
+func (h *AnalyticsHandler) GetExitPages(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	page, limit := parsePagination(r, 10, 100)
+	from, to := parseDateRange(r)
+
+	args := pageReportArgs(projectID.String(), analytics.ExitPageDimension, page, limit)
+	span, partial, err := h.pageReportSpan(projectID.String(), analytics.ExitPageDimension, from, to, page, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute exit pages")
+		return
+	}
+	parts := span.SQL(args, rolledPagesSQL,
+		func(within func(string) string) string {
+			return `
+		SELECT l.path AS value,
+			COUNT(*) AS sessions,
+			COUNT(DISTINCT l.visitor_id) AS visitors,
+			MAX(p.views) AS views,
+			0 AS bounces,
+			0 AS duration
+		FROM (
+			SELECT DISTINCT ON (session_id) session_id, visitor_id, path
+			FROM page_views
+			WHERE project_id = @project AND ` + within("created_at") + `
+			ORDER BY session_id, created_at DESC
+		) l
+		JOIN (
+			SELECT path, COUNT(*) AS views
+			FROM page_views
+			WHERE project_id = @project AND ` + within("created_at") + `
+			GROUP BY path
+		) p ON p.path = l.path
+		GROUP BY l.path`
+		})
+
+	var rows []exitPageRow
+	err = h.DB.Raw(`
+		SELECT value AS page,
+			SUM(sessions) AS exits,
+			SUM(visitors) AS visitors,
+			SUM(views) AS views,
+			COALESCE(SUM(sessions) * 100.0 / NULLIF(SUM(views), 0), 0) AS exit_rate
+		FROM (`+parts+`
+		) parts
+		GROUP BY value
+		ORDER BY exits DESC, page
+		LIMIT @limit OFFSET @offset`, args).Scan(&rows).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute exit pages")
+		return
+	}
+
+	total, err := h.countPageValues(parts, args)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute exit pages")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"partial": partial,
+		"results": rows,
+	})
+}
+
+// rolledPagesSQL reads the entry or exit page rollups of the finalized
+// days, which hold the same columns as the raw queries of the reports.
+const rolledPagesSQL = `
+		SELECT value, sessions, visitors, views, bounces, duration
+		FROM dimension_rollups
+		WHERE project_id = @project AND dimension = @dimension
+			AND bucket >= @day_start AND bucket < @day_end`
+
+// countPageValues returns how many pages a report ranks in total, not just
+// on the requested page of results.
+func (h *AnalyticsHandler) countPageValues(parts string, args map[string]interface{}) (int64, error) {
+	var total int64
+	err := h.DB.Raw(`SELECT COUNT(DISTINCT value) FROM (`+parts+`
+		) parts`, args).Scan(&total).Error
+	return total, err
+}
+
+// pageReportSpan splits the range of an entry or exit page report, reading
+// the days past the top pages from raw rows for pages beyond them.
+func (h *AnalyticsHandler) pageReportSpan(projectID, dimension string, from, to time.Time, page, limit int) (analytics.Span, bool, error) {
+	deep := page*limit > analytics.TopDimensionValues
+	return analytics.TopSpan(h.DB, projectID, dimension, from, to.Add(time.Second), deep)
+}
+
+func pageReportArgs(projectID, dimension string, page, limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"project":   projectID,
+		"dimension": dimension,
+		"limit":     limit,
+		"offset":    (page - 1) * limit,
+	}
+}
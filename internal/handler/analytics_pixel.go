@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// pixelGIF is a transparent 1x1 GIF.
+var pixelGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// GET /analytics/pixel.gif
+//
+// Records a page view for pages that cannot run the tracker, such as AMP
+// pages, <noscript> fallbacks and emails, and answers with a transparent
+// GIF. The page is taken from url=, or from the Referer header when url= is
+// missing; referrer= and title= are optional.
+//
+// Once the project is known the GIF is always served, even when the hit is
+// not recorded, so that nothing shows up broken on the page.
+func (h *AnalyticsHandler) Pixel(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	projectID, err := uuid.Parse(query.Get("project_id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid project_id")
+		return
+	}
+
+	var project models.Project
+	if err := h.DB.First(&project, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	payload := TrackPayload{
+		ProjectID: projectID.String(),
+		URL:       query.Get("url"),
+		Referrer:  query.Get("referrer"),
+		Title:     query.Get("title"),
+	}
+	if payload.URL == "" {
+		payload.URL = r.Referer()
+	}
+
+	if h.pixelAllowed(r, project) {
+		h.trackPixel(r, projectID, payload)
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(http.StatusOK)
+	w.Write(pixelGIF)
+}
+
+// pixelAllowed reports whether a pixel request should be recorded. Email
+// clients send no Referer, so the project's AllowedOrigins only reject
+// requests whose Referer names another site.
+func (h *AnalyticsHandler) pixelAllowed(r *http.Request, project models.Project) bool {
+	if project.RespectDNT && utils.DoNotTrack(r) {
+		return false
+	}
+	if len(project.AllowedOrigins) > 0 && r.Referer() != "" {
+		ref, err := url.Parse(r.Referer())
+		if err != nil || !utils.OriginAllowed(project.AllowedOrigins, ref.Scheme+"://"+ref.Host) {
+			return false
+		}
+	}
+	return h.filterReason(r, project, utils.DetectBot(r)) == ""
+}
+
+// trackPixel records the page view of a pixel request. Failures are only
+// logged, and a full queue drops the hit, since the response is the same
+// image either way.
+func (h *AnalyticsHandler) trackPixel(r *http.Request, projectID uuid.UUID, payload TrackPayload) {
+	parsedURL, err := url.Parse(payload.URL)
+	if err != nil || payload.URL == "" {
+		return
+	}
+
+	visitorIDs, err := h.fingerprints(utils.ClientIP(r), r.UserAgent(), payload.ProjectID)
+	if err != nil {
+		log.Printf("pixel: could not compute visitor id: %v", err)
+		return
+	}
+
+	hit, session, _, err := h.pageViewHit(r, projectID, visitorIDs, parsedURL, payload)
+	if err != nil {
+		log.Printf("pixel: could not resolve session: %v", err)
+		return
+	}
+
+	if err := h.Ingest.Enqueue(hit); err != nil {
+		return
+	}
+	h.publishPageView(hit.PageView, session)
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"jiramo/internal/analytics"
+	"jiramo/internal/utils"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type propertyKey struct {
+	Key    string `json:"key"`
+	Events int64  `json:"events"`
+}
+
+type propertyRow struct {
+	Value    string   `json:"value"`
+	Events   int64    `json:"events"`
+	Visitors int64    `json:"visitors"`
+	Sum      *float64 `json:"sum,omitempty"`
+	Avg      *float64 `json:"avg,omitempty"`
+}
+
+// GET /projects/{id}/analytics/events/{name}/properties
+func (h *AnalyticsHandler) GetEventPropertyKeys(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	from, to := parseDateRange(r)
+
+	var keys []propertyKey
+	err := h.DB.Raw(`
+		SELECT k.key, COUNT(*) AS events
+		FROM analytics_events e, jsonb_object_keys(e.properties) AS k(key)
+		WHERE e.project_id = ? AND e.event_name = ? AND e.created_at BETWEEN ? AND ?
+		GROUP BY k.key
+		ORDER BY events DESC, k.key
+		LIMIT 100`,
+		projectID, mux.Vars(r)["name"], from, to).Scan(&keys).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not list event properties")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, keys)
+}
+
+// GET /projects/{id}/analytics/events/{name}?property=plan&metric=amount
+//
+// Groups an event by the value of property, or returns a single row when
+// it is omitted. With metric, each row also carries the sum and average of
+// that numeric property; non-numeric values are ignored.
+func (h *AnalyticsHandler) GetEventBreakdown(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	property := r.URL.Query().Get("property")
+	if property != "" && !analytics.ValidPropertyKey(property) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid property")
+		return
+	}
+	metric := r.URL.Query().Get("metric")
+	if metric != "" && !analytics.ValidPropertyKey(metric) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid metric")
+		return
+	}
+
+	page, limit := parsePagination(r, 10, 100)
+	from, to := parseDateRange(r)
+
+	value := "CAST('' AS text)"
+	if property != "" {
+		value = "COALESCE(properties->>CAST(@property AS text), '')"
+	}
+	aggregates := ""
+	if metric != "" {
+		number := "CASE WHEN jsonb_typeof(properties->CAST(@metric AS text)) = 'number' THEN CAST(properties->>CAST(@metric AS text) AS double precision) END"
+		aggregates = ", SUM(" + number + ") AS sum, AVG(" + number + ") AS avg"
+	}
+
+	args := map[string]interface{}{
+		"project":  projectID,
+		"name":     mux.Vars(r)["name"],
+		"property": property,
+		"metric":   metric,
+		"from":     from,
+		"to":       to,
+		"limit":    limit,
+		"offset":   (page - 1) * limit,
+	}
+	source := " FROM analytics_events WHERE project_id = @project AND event_name = @name AND created_at BETWEEN @from AND @to"
+
+	var rows []propertyRow
+	err := h.DB.Raw(`
+		SELECT `+value+` AS value,
+			COUNT(*) AS events,
+			COUNT(DISTINCT visitor_id) AS visitors`+aggregates+source+`
+		GROUP BY 1
+		ORDER BY events DESC, value
+		LIMIT @limit OFFSET @offset`, args).Scan(&rows).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute event breakdown")
+		return
+	}
+
+	var total int64
+	if err := h.DB.Raw(`SELECT COUNT(DISTINCT `+value+`)`+source, args).Scan(&total).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute event breakdown")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"event":    mux.Vars(r)["name"],
+		"property": property,
+		"metric":   metric,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+		"results":  rows,
+	})
+}
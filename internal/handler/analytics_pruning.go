@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+)
+
+// GET /projects/{id}/analytics/pruning
+func (h *AnalyticsHandler) GetPruneRuns(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var runs []models.PruneRun
+	err := h.DB.Where("project_id = ?", projectID).
+		Order("created_at DESC").
+		Limit(100).
+		Find(&runs).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve prune runs")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, runs)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"jiramo/internal/analytics"
+	"jiramo/internal/ingest"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServerEventPayload is an event reported by a project's backend on behalf
+// of a visitor.
+type ServerEventPayload struct {
+	EventName string          `json:"event_name"`
+	URL       string          `json:"url"`
+	Props     json.RawMessage `json:"props"`
+
+	// VisitorIP and UserAgent are those of the visitor's request, so the
+	// event joins the session the tracker started in the browser.
+	VisitorIP string `json:"visitor_ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+// POST /projects/{id}/events
+//
+// Records an event sent by the project's server, authenticated with an API
+// key of the project. Bot and Do Not Track filtering are left to the caller;
+// the project's excluded IPs still apply to visitor_ip.
+func (h *AnalyticsHandler) TrackServerEvent(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var payload ServerEventPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	if strings.TrimSpace(payload.EventName) == "" || len(payload.EventName) > maxEventNameLength {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid event name")
+		return
+	}
+	ip, err := netip.ParseAddr(payload.VisitorIP)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid visitor_ip")
+		return
+	}
+	if strings.TrimSpace(payload.UserAgent) == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user_agent")
+		return
+	}
+
+	props, err := analytics.ParseProperties(payload.Props)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid props: "+err.Error())
+		return
+	}
+
+	parsedURL, err := url.Parse(payload.URL)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid URL")
+		return
+	}
+
+	var project models.Project
+	if err := h.DB.First(&project, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	if utils.AddrExcluded(ip.String(), project.ExcludedIPs) {
+		h.Ingest.Enqueue(ingest.Hit{Filtered: &ingest.Filtered{
+			ProjectID: project.ID,
+			Reason:    utils.BotExcludedIP,
+			At:        time.Now(),
+		}})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	visitorIDs, err := h.fingerprints(ip.String(), payload.UserAgent, projectID.String())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute visitor id")
+		return
+	}
+
+	session, found, _, err := h.Ingest.Sessions.Resolve(projectID.String(), visitorIDs, nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not resolve session")
+		return
+	}
+
+	sessionID, visitorID := session.SessionID, session.VisitorID
+	if !found {
+		visitorID = visitorIDs[0]
+		sessionID = utils.NewSessionID(visitorID)
+	}
+
+	event := models.AnalyticsEvent{
+		ID:         uuid.New(),
+		ProjectID:  projectID,
+		SessionID:  sessionID,
+		VisitorID:  visitorID,
+		URL:        payload.URL,
+		Path:       parsedURL.Path,
+		EventName:  payload.EventName,
+		Properties: props,
+		CreatedAt:  time.Now(),
+	}
+
+	hit := ingest.Hit{Event: &event}
+	if found {
+		hit.TouchSession = sessionID
+	}
+	if !h.enqueue(w, hit) {
+		return
+	}
+	h.publishEvent(&event, session)
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{
+		"event_id":   event.ID.String(),
+		"session_id": sessionID,
+	})
+}
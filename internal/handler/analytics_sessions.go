@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"jiramo/internal/analytics"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type sessionSummary struct {
+	SessionID   string    `json:"session_id"`
+	VisitorID   string    `json:"visitor_id"`
+	Hostname    string    `json:"hostname"`
+	Browser     string    `json:"browser"`
+	OS          string    `json:"os"`
+	Device      string    `json:"device"`
+	Country     string    `json:"country"`
+	Region      string    `json:"region"`
+	City        string    `json:"city"`
+	Language    string    `json:"language"`
+	Referrer    string    `json:"referrer"`
+	UTMSource   string    `json:"utm_source"`
+	UTMMedium   string    `json:"utm_medium"`
+	UTMCampaign string    `json:"utm_campaign"`
+	Channel     string    `json:"channel"`
+	EntryPage   string    `json:"entry_page"`
+	ExitPage    string    `json:"exit_page"`
+	Views       int64     `json:"views"`
+	Events      int64     `json:"events"`
+	Duration    int64     `json:"duration"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+type timelineItem struct {
+	Type       string            `json:"type"`
+	ID         uuid.UUID         `json:"id"`
+	URL        string            `json:"url"`
+	Path       string            `json:"path"`
+	Title      string            `json:"title,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Properties models.Properties `json:"properties,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	ErrorID    *uuid.UUID        `json:"error_id,omitempty"`
+	Duration   int               `json:"duration"`
+	Offset     int               `json:"offset"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// GET /projects/{id}/analytics/sessions
+//
+// Lists the sessions started in the date range, newest first. Sessions can
+// be filtered by any session dimension with filter[<dimension>]=<value>,
+// by entry_page, and by goal=<goal id> to keep those that reached a goal.
+func (h *AnalyticsHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	filters, err := parseDimensionFilters(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := filters["page"]; ok {
+		utils.WriteError(w, http.StatusBadRequest, "Filter page is not supported for sessions, use entry_page")
+		return
+	}
+
+	page, limit := parsePagination(r, 20, 100)
+	from, to := parseDateRange(r)
+
+	args := map[string]interface{}{
+		"project": projectID,
+		"from":    from,
+		"to":      to,
+		"limit":   limit,
+		"offset":  (page - 1) * limit,
+	}
+	where := analytics.DimensionFilterSQL(filters, args)
+
+	if entryPage := r.URL.Query().Get("entry_page"); entryPage != "" {
+		where += " AND first_view.path = @entry_page"
+		args["entry_page"] = entryPage
+	}
+
+	if goalID := r.URL.Query().Get("goal"); goalID != "" {
+		id, err := uuid.Parse(goalID)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid goal id")
+			return
+		}
+		var goal models.Goal
+		if err := h.DB.First(&goal, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+			utils.WriteError(w, http.StatusNotFound, "Goal not found")
+			return
+		}
+		table, cond, arg := analytics.GoalMatch(goal.Type, goal.PathPattern, goal.EventName)
+		where += " AND EXISTS (SELECT 1 FROM " + table + " g WHERE g.session_id = s.session_id AND " +
+			strings.Replace(cond, "?", "@goal", 1) + ")"
+		args["goal"] = arg
+	}
+
+	var sessions []sessionSummary
+	err = h.DB.Raw(`
+		SELECT s.session_id, s.visitor_id, s.hostname, s.browser, s.os, s.device,
+			s.country, s.region, s.city, s.language, s.referrer,
+			s.utm_source, s.utm_medium, s.utm_campaign, s.channel,
+			COALESCE(first_view.path, '') AS entry_page,
+			COALESCE(last_view.path, '') AS exit_page,
+			COALESCE(stats.views, 0) AS views,
+			COALESCE(stats.duration, 0) AS duration,
+			(SELECT COUNT(*) FROM analytics_events e WHERE e.session_id = s.session_id) AS events,
+			s.created_at,
+			COALESCE(stats.last_seen_at, s.created_at) AS last_seen_at
+		FROM sessions s
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) AS views, SUM(duration) AS duration, MAX(created_at) AS last_seen_at
+			FROM page_views WHERE session_id = s.session_id
+		) stats ON true
+		LEFT JOIN LATERAL (
+			SELECT path FROM page_views WHERE session_id = s.session_id ORDER BY created_at LIMIT 1
+		) first_view ON true
+		LEFT JOIN LATERAL (
+			SELECT path FROM page_views WHERE session_id = s.session_id ORDER BY created_at DESC LIMIT 1
+		) last_view ON true
+		WHERE s.project_id = @project AND s.created_at BETWEEN @from AND @to`+where+`
+		ORDER BY s.created_at DESC
+		LIMIT @limit OFFSET @offset`, args).Scan(&sessions).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve sessions")
+		return
+	}
+
+	var total int64
+	err = h.DB.Raw(`
+		SELECT COUNT(*)
+		FROM sessions s
+		LEFT JOIN LATERAL (
+			SELECT path FROM page_views WHERE session_id = s.session_id ORDER BY created_at LIMIT 1
+		) first_view ON true
+		WHERE s.project_id = @project AND s.created_at BETWEEN @from AND @to`+where, args).Scan(&total).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve sessions")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"results": sessions,
+	})
+}
+
+// GET /projects/{id}/analytics/sessions/{sessionId}
+//
+// Returns a session with its page views, events and JavaScript errors in
+// time order. A page view without a recorded duration lasts until the next
+// page view.
+func (h *AnalyticsHandler) GetSessionTimeline(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	sessionID := mux.Vars(r)["sessionId"]
+
+	var session models.Session
+	if err := h.DB.First(&session, "project_id = ? AND session_id = ?", projectID, sessionID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	var views []models.PageView
+	if err := h.DB.Where("session_id = ?", sessionID).Order("created_at").Find(&views).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve page views")
+		return
+	}
+
+	var events []models.AnalyticsEvent
+	if err := h.DB.Where("session_id = ?", sessionID).Order("created_at").Find(&events).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve events")
+		return
+	}
+
+	var errs []models.ErrorOccurrence
+	if err := h.DB.Where("session_id = ?", sessionID).Order("created_at").Find(&errs).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve errors")
+		return
+	}
+
+	timeline := make([]timelineItem, 0, len(views)+len(events)+len(errs))
+	for i, v := range views {
+		duration := v.Duration
+		if duration == 0 && i+1 < len(views) {
+			duration = int(views[i+1].CreatedAt.Sub(v.CreatedAt).Seconds())
+		}
+		timeline = append(timeline, timelineItem{
+			Type:      "pageview",
+			ID:        v.ID,
+			URL:       v.URL,
+			Path:      v.Path,
+			Title:     v.Title,
+			Duration:  duration,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+	for _, e := range events {
+		timeline = append(timeline, timelineItem{
+			Type:       "event",
+			ID:         e.ID,
+			URL:        e.URL,
+			Path:       e.Path,
+			Name:       e.EventName,
+			Properties: e.Properties,
+			CreatedAt:  e.CreatedAt,
+		})
+	}
+
+	for _, e := range errs {
+		groupID := e.GroupID
+		timeline = append(timeline, timelineItem{
+			Type:      "error",
+			ID:        e.ID,
+			URL:       e.URL,
+			Path:      e.Path,
+			Message:   e.Message,
+			ErrorID:   &groupID,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].CreatedAt.Before(timeline[j].CreatedAt)
+	})
+
+	var duration int
+	for i := range timeline {
+		timeline[i].Offset = int(timeline[i].CreatedAt.Sub(session.CreatedAt).Seconds())
+		if timeline[i].Type == "pageview" {
+			duration += timeline[i].Duration
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"session":  session,
+		"duration": duration,
+		"timeline": timeline,
+	})
+}
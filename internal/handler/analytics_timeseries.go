@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"jiramo/internal/analytics"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"time"
+)
+
+const maxTimeseriesBuckets = 2000
+
+var timeseriesIntervals = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+type timeseriesPoint struct {
+	Bucket   time.Time `json:"bucket"`
+	Views    int64     `json:"views"`
+	Visitors int64     `json:"visitors"`
+	Sessions int64     `json:"sessions"`
+
+	// Previous and Change are set when comparing; Previous is the point at
+	// the same position in the compared series.
+	Previous *timeseriesPoint    `json:"previous,omitempty"`
+	Change   map[string]*float64 `json:"change,omitempty"`
+}
+
+func (p timeseriesPoint) metrics() map[string]float64 {
+	return map[string]float64{
+		"views":    float64(p.Views),
+		"visitors": float64(p.Visitors),
+		"sessions": float64(p.Sessions),
+	}
+}
+
+// GET /projects/{id}/analytics/timeseries
+func (h *AnalyticsHandler) GetTimeseries(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	step, ok := timeseriesIntervals[interval]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid interval, expected hour, day, week or month")
+		return
+	}
+
+	loc, ok := locationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	from, to := parseDateRangeIn(r, loc)
+	if !to.After(from) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid date range")
+		return
+	}
+	if to.Sub(from)/step > maxTimeseriesBuckets {
+		utils.WriteError(w, http.StatusBadRequest, "Date range too large for the selected interval")
+		return
+	}
+	compare, ok := parseCompare(w, r, from, to)
+	if !ok {
+		return
+	}
+
+	series, err := h.series(projectID.String(), interval, loc, from, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute timeseries")
+		return
+	}
+
+	response := map[string]interface{}{
+		"interval": interval,
+		"timezone": loc.String(),
+		"from":     from,
+		"to":       to,
+		"series":   series,
+	}
+
+	if compare != nil {
+		previous, err := h.series(projectID.String(), interval, loc, compare.From, compare.To)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Could not compute timeseries")
+			return
+		}
+		for i := range series {
+			prev := timeseriesPoint{}
+			if i < len(previous) {
+				prev = previous[i]
+			}
+			series[i].Previous = &prev
+			series[i].Change = metricChanges(series[i].metrics(), prev.metrics())
+		}
+		response["comparison"] = compare
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// series picks the rollup-backed query when the buckets line up with the
+// UTC rollups and the raw query otherwise.
+func (h *AnalyticsHandler) series(projectID, interval string, loc *time.Location, from, to time.Time) ([]timeseriesPoint, error) {
+	if loc == time.UTC && (interval == "hour" || interval == "day") {
+		return h.timeseriesWithRollups(projectID, interval, from, to)
+	}
+	return h.timeseries(projectID, interval, loc, from, to)
+}
+
+// timeseries buckets page views, visitors and sessions by interval in the
+// given location. Buckets are generated in SQL so that empty periods are
+// returned as zeros instead of being missing from the series.
+func (h *AnalyticsHandler) timeseries(projectID, interval string, loc *time.Location, from, to time.Time) ([]timeseriesPoint, error) {
+	tz := loc.String()
+
+	type row struct {
+		Bucket   time.Time
+		Views    int64
+		Visitors int64
+		Sessions int64
+	}
+
+	var rows []row
+	err := h.DB.Raw(`
+		WITH buckets AS (
+			SELECT generate_series(
+				date_trunc(@interval, CAST(@from AS timestamptz) AT TIME ZONE @tz),
+				date_trunc(@interval, CAST(@to AS timestamptz) AT TIME ZONE @tz),
+				CAST(@step AS interval)
+			) AS bucket
+		),
+		views AS (
+			SELECT date_trunc(@interval, created_at AT TIME ZONE @tz) AS bucket,
+				COUNT(*) AS views,
+				COUNT(DISTINCT visitor_id) AS visitors
+			FROM page_views
+			WHERE project_id = @project AND created_at BETWEEN @from AND @to
+			GROUP BY 1
+		),
+		sessions AS (
+			SELECT date_trunc(@interval, created_at AT TIME ZONE @tz) AS bucket,
+				COUNT(*) AS sessions
+			FROM sessions
+			WHERE project_id = @project AND created_at BETWEEN @from AND @to
+			GROUP BY 1
+		)
+		SELECT b.bucket,
+			COALESCE(v.views, 0) AS views,
+			COALESCE(v.visitors, 0) AS visitors,
+			COALESCE(s.sessions, 0) AS sessions
+		FROM buckets b
+		LEFT JOIN views v ON v.bucket = b.bucket
+		LEFT JOIN sessions s ON s.bucket = b.bucket
+		ORDER BY b.bucket`,
+		map[string]interface{}{
+			"interval": interval,
+			"step":     "1 " + interval,
+			"tz":       tz,
+			"project":  projectID,
+			"from":     from,
+			"to":       to,
+		}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]timeseriesPoint, len(rows))
+	for i, rw := range rows {
+		series[i] = timeseriesPoint{
+			Bucket:   inLocation(rw.Bucket, loc),
+			Views:    rw.Views,
+			Visitors: rw.Visitors,
+			Sessions: rw.Sessions,
+		}
+	}
+	return series, nil
+}
+
+// timeseriesWithRollups serves UTC hourly and daily series from the rollup
+// tables, querying raw rows only for buckets past the rollup watermark.
+func (h *AnalyticsHandler) timeseriesWithRollups(projectID, interval string, from, to time.Time) ([]timeseriesPoint, error) {
+	step := timeseriesIntervals[interval]
+	first := from.UTC().Truncate(step)
+	rawStart := analytics.Watermark(h.DB).Truncate(step)
+	if !rawStart.After(first) {
+		return h.timeseries(projectID, interval, time.UTC, from, to)
+	}
+
+	rolled, err := analytics.RollupBuckets(h.DB, projectID, models.RollupGranularity(interval), first, rawStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var series []timeseriesPoint
+	for b := first; b.Before(rawStart) && !b.After(to); b = b.Add(step) {
+		rollup := rolled[b.Unix()]
+		series = append(series, timeseriesPoint{
+			Bucket:   b,
+			Views:    rollup.Views,
+			Visitors: rollup.Visitors,
+			Sessions: rollup.Sessions,
+		})
+	}
+
+	if rawStart.After(to) {
+		return series, nil
+	}
+	raw, err := h.timeseries(projectID, interval, time.UTC, rawStart, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(series, raw...), nil
+}
+
+// inLocation reinterprets a wall-clock timestamp returned by Postgres
+// (timestamp without time zone) as a time in loc.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"encoding/json"
+	"jiramo/internal/analytics"
+	"jiramo/internal/ingest"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type VitalsPayload struct {
+	ProjectID string             `json:"project_id"`
+	ViewID    string             `json:"view_id"`
+	URL       string             `json:"url"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+type vitalSummary struct {
+	Name    string   `json:"name"`
+	Samples int64    `json:"samples"`
+	P75     *float64 `json:"p75"`
+	Rating  string   `json:"rating,omitempty"`
+	Good    float64  `json:"good"`
+	Poor    float64  `json:"poor"`
+
+	Previous *vitalSummary `json:"previous,omitempty"`
+	Change   *float64      `json:"change,omitempty"`
+}
+
+type vitalsRow struct {
+	Value   string   `json:"value"`
+	Samples int64    `json:"samples"`
+	LCP     *float64 `json:"lcp"`
+	INP     *float64 `json:"inp"`
+	CLS     *float64 `json:"cls"`
+	FCP     *float64 `json:"fcp"`
+	TTFB    *float64 `json:"ttfb"`
+}
+
+// vitalDimensions maps the dimensions web vitals can be grouped by to their
+// column.
+var vitalDimensions = map[string]string{
+	"page":   "path",
+	"device": "device",
+}
+
+// POST /analytics/vitals
+//
+// Records the Core Web Vitals of a page view, sent by the tracker once the
+// page is hidden.
+func (h *AnalyticsHandler) TrackVitals(w http.ResponseWriter, r *http.Request) {
+	var payload VitalsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	projectID, err := uuid.Parse(payload.ProjectID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid project_id")
+		return
+	}
+
+	if len(payload.Metrics) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "No metrics")
+		return
+	}
+	for name, value := range payload.Metrics {
+		vital, ok := analytics.LookupVital(name)
+		if !ok {
+			utils.WriteError(w, http.StatusBadRequest, "Unknown metric "+name)
+			return
+		}
+		if !vital.Valid(value) {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid value for "+name)
+			return
+		}
+	}
+
+	var viewID *uuid.UUID
+	if payload.ViewID != "" {
+		id, err := uuid.Parse(payload.ViewID)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid view_id")
+			return
+		}
+		viewID = &id
+	}
+
+	var project models.Project
+	if err := h.DB.First(&project, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	if project.RespectDNT && utils.DoNotTrack(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if h.filtered(w, r, project) {
+		return
+	}
+
+	parsedURL, err := url.Parse(payload.URL)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid URL")
+		return
+	}
+
+	visitorIDs, ok := h.visitorIDs(w, r, payload.ProjectID)
+	if !ok {
+		return
+	}
+
+	session, found, _, err := h.Ingest.Sessions.Resolve(projectID.String(), visitorIDs, nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not resolve session")
+		return
+	}
+
+	sessionID, device := session.SessionID, session.Device
+	if !found {
+		sessionID = utils.NewSessionID(visitorIDs[0])
+		_, _, device = utils.ParseUserAgent(r.UserAgent())
+	}
+
+	now := time.Now()
+	vitals := make([]models.WebVital, 0, len(payload.Metrics))
+	for name, value := range payload.Metrics {
+		vitals = append(vitals, models.WebVital{
+			ID:        uuid.New(),
+			ProjectID: projectID,
+			SessionID: sessionID,
+			ViewID:    viewID,
+			Path:      parsedURL.Path,
+			Device:    device,
+			Name:      name,
+			Value:     value,
+			CreatedAt: now,
+		})
+	}
+
+	if !h.enqueue(w, ingest.Hit{Vitals: vitals}) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GET /projects/{id}/analytics/vitals
+//
+// Returns the 75th percentile of each metric with its rating and the share
+// of good and poor measurements. Narrow it with page= and device=, and add
+// compare= to check the effect of a change against an earlier period.
+func (h *AnalyticsHandler) GetVitals(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	from, to := parseDateRange(r)
+	compare, ok := parseCompare(w, r, from, to)
+	if !ok {
+		return
+	}
+	page := r.URL.Query().Get("page")
+	device := r.URL.Query().Get("device")
+
+	metrics, err := h.vitalsSummary(projectID, page, device, from, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute web vitals")
+		return
+	}
+
+	response := map[string]interface{}{
+		"metrics": metrics,
+	}
+
+	if compare != nil {
+		previous, err := h.vitalsSummary(projectID, page, device, compare.From, compare.To)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Could not compute web vitals")
+			return
+		}
+		for i := range metrics {
+			prev := previous[i]
+			metrics[i].Previous = &prev
+			if metrics[i].P75 != nil && prev.P75 != nil {
+				metrics[i].Change = percentChange(*metrics[i].P75, *prev.P75)
+			}
+		}
+		response["comparison"] = compare
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// GET /projects/{id}/analytics/vitals/{dimension}
+//
+// Lists the 75th percentile of every metric per page or per device, most
+// measured first or, with sort=<metric>, slowest first.
+func (h *AnalyticsHandler) GetVitalsBreakdown(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	dimension := mux.Vars(r)["dimension"]
+	column, ok := vitalDimensions[dimension]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Unknown dimension, expected page or device")
+		return
+	}
+
+	order := "samples DESC"
+	if sort := r.URL.Query().Get("sort"); sort != "" {
+		vital, ok := analytics.LookupVital(strings.ToUpper(sort))
+		if !ok {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid sort")
+			return
+		}
+		order = strings.ToLower(vital.Name) + " DESC NULLS LAST"
+	}
+
+	page, limit := parsePagination(r, 10, 100)
+	from, to := parseDateRange(r)
+
+	args := map[string]interface{}{
+		"project": projectID,
+		"from":    from,
+		"to":      to,
+		"limit":   limit,
+		"offset":  (page - 1) * limit,
+	}
+	where := ""
+	if v := r.URL.Query().Get("page"); v != "" && dimension != "page" {
+		where += " AND path = @page"
+		args["page"] = v
+	}
+	if v := r.URL.Query().Get("device"); v != "" && dimension != "device" {
+		where += " AND device = @device"
+		args["device"] = v
+	}
+
+	columns := make([]string, len(analytics.Vitals))
+	for i, vital := range analytics.Vitals {
+		columns[i] = "percentile_cont(0.75) WITHIN GROUP (ORDER BY value) FILTER (WHERE name = '" +
+			vital.Name + "') AS " + strings.ToLower(vital.Name)
+	}
+
+	var rows []vitalsRow
+	err := h.DB.Raw(`
+		SELECT COALESCE(`+column+`, '') AS value, COUNT(*) AS samples,
+			`+strings.Join(columns, ",\n\t\t\t")+`
+		FROM web_vitals
+		WHERE project_id = @project AND created_at BETWEEN @from AND @to`+where+`
+		GROUP BY 1
+		ORDER BY `+order+`, 1
+		LIMIT @limit OFFSET @offset`, args).Scan(&rows).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute web vitals")
+		return
+	}
+
+	var total int64
+	err = h.DB.Raw(`
+		SELECT COUNT(DISTINCT COALESCE(`+column+`, ''))
+		FROM web_vitals
+		WHERE project_id = @project AND created_at BETWEEN @from AND @to`+where, args).Scan(&total).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not compute web vitals")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"dimension": dimension,
+		"page":      page,
+		"limit":     limit,
+		"total":     total,
+		"results":   rows,
+	})
+}
+
+// vitalsSummary computes one summary per metric, in the order of
+// analytics.Vitals. Good and Poor are percentages of the samples.
+func (h *AnalyticsHandler) vitalsSummary(projectID uuid.UUID, page, device string, from, to time.Time) ([]vitalSummary, error) {
+	var thresholds []string
+	var args []interface{}
+	for _, vital := range analytics.Vitals {
+		thresholds = append(thresholds, "(CAST(? AS text), CAST(? AS double precision), CAST(? AS double precision))")
+		args = append(args, vital.Name, vital.Good, vital.Poor)
+	}
+
+	where := ""
+	args = append(args, projectID, from, to)
+	if page != "" {
+		where += " AND v.path = ?"
+		args = append(args, page)
+	}
+	if device != "" {
+		where += " AND v.device = ?"
+		args = append(args, device)
+	}
+
+	var rows []struct {
+		Name    string
+		Samples int64
+		P75     float64
+		Good    int64
+		Poor    int64
+	}
+	err := h.DB.Raw(`
+		SELECT v.name, COUNT(*) AS samples,
+			percentile_cont(0.75) WITHIN GROUP (ORDER BY v.value) AS p75,
+			COUNT(*) FILTER (WHERE v.value <= t.good) AS good,
+			COUNT(*) FILTER (WHERE v.value > t.poor) AS poor
+		FROM web_vitals v
+		JOIN (VALUES `+strings.Join(thresholds, ", ")+`) AS t(name, good, poor) ON t.name = v.name
+		WHERE v.project_id = ? AND v.created_at BETWEEN ? AND ?`+where+`
+		GROUP BY v.name`, args...).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]vitalSummary, len(analytics.Vitals))
+	for i, vital := range analytics.Vitals {
+		summaries[i].Name = vital.Name
+		for _, row := range rows {
+			if row.Name != vital.Name || row.Samples == 0 {
+				continue
+			}
+			p75 := row.P75
+			summaries[i].Samples = row.Samples
+			summaries[i].P75 = &p75
+			summaries[i].Rating = rateVital(vital, p75)
+			summaries[i].Good = float64(row.Good) / float64(row.Samples) * 100
+			summaries[i].Poor = float64(row.Poor) / float64(row.Samples) * 100
+		}
+	}
+	return summaries, nil
+}
+
+func rateVital(vital analytics.Vital, value float64) string {
+	switch {
+	case value <= vital.Good:
+		return "good"
+	case value <= vital.Poor:
+		return "needs_improvement"
+	default:
+		return "poor"
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type GoalHandler struct {
+	DB       *gorm.DB
+	Validate *validator.Validate
+}
+
+func NewGoalHandler(db *gorm.DB) *GoalHandler {
+	return &GoalHandler{DB: db, Validate: validator.New()}
+}
+
+type GoalInput struct {
+	Name        string          `json:"name" validate:"required,max=64"`
+	Type        models.GoalType `json:"type" validate:"required,oneof=page event"`
+	PathPattern string          `json:"path_pattern" validate:"required_if=Type page,max=255"`
+	EventName   string          `json:"event_name" validate:"required_if=Type event,max=255"`
+}
+
+type FunnelInput struct {
+	Name            string      `json:"name" validate:"required,max=64"`
+	MaxStepInterval int         `json:"max_step_interval" validate:"min=0"`
+	Steps           []GoalInput `json:"steps" validate:"min=2,max=10,dive"`
+}
+
+// GET /projects/{id}/goals
+func (h *GoalHandler) ListGoals(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var goals []models.Goal
+	if err := h.DB.Where("project_id = ?", projectID).Order("created_at").Find(&goals).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve goals")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, goals)
+}
+
+// POST /projects/{id}/goals
+func (h *GoalHandler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := h.findProject(w, r)
+	if !ok {
+		return
+	}
+
+	var input GoalInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := h.Validate.Struct(input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	goal := models.Goal{
+		ID:          uuid.New(),
+		ProjectID:   projectID,
+		Name:        input.Name,
+		Type:        input.Type,
+		PathPattern: input.PathPattern,
+		EventName:   input.EventName,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := h.DB.Create(&goal).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during creation")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, goal)
+}
+
+// DELETE /projects/{id}/goals/{goalId}
+func (h *GoalHandler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	h.deleteByID(w, r, &models.Goal{}, "goalId", "goal")
+}
+
+// GET /projects/{id}/funnels
+func (h *GoalHandler) ListFunnels(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var funnels []models.Funnel
+	err := h.DB.
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Where("project_id = ?", projectID).
+		Order("created_at").
+		Find(&funnels).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve funnels")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, funnels)
+}
+
+// POST /projects/{id}/funnels
+func (h *GoalHandler) CreateFunnel(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := h.findProject(w, r)
+	if !ok {
+		return
+	}
+
+	var input FunnelInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := h.Validate.Struct(input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	funnel := models.Funnel{
+		ID:              uuid.New(),
+		ProjectID:       projectID,
+		Name:            input.Name,
+		MaxStepInterval: input.MaxStepInterval,
+		CreatedAt:       time.Now(),
+	}
+	for i, step := range input.Steps {
+		funnel.Steps = append(funnel.Steps, models.FunnelStep{
+			ID:          uuid.New(),
+			FunnelID:    funnel.ID,
+			Position:    i + 1,
+			Name:        step.Name,
+			Type:        step.Type,
+			PathPattern: step.PathPattern,
+			EventName:   step.EventName,
+		})
+	}
+
+	if err := h.DB.Create(&funnel).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during creation")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, funnel)
+}
+
+// DELETE /projects/{id}/funnels/{funnelId}
+func (h *GoalHandler) DeleteFunnel(w http.ResponseWriter, r *http.Request) {
+	h.deleteByID(w, r, &models.Funnel{}, "funnelId", "funnel")
+}
+
+func (h *GoalHandler) findProject(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+	if err := h.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return uuid.Nil, false
+	}
+	return projectID, true
+}
+
+// deleteByID deletes a project-scoped row identified by the idVar route
+// variable.
+func (h *GoalHandler) deleteByID(w http.ResponseWriter, r *http.Request, model interface{}, idVar, name string) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)[idVar])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid "+name+" id")
+		return
+	}
+
+	result := h.DB.Delete(model, "id = ? AND project_id = ?", id, projectID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete "+name)
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, name+" not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
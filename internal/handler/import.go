@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"jiramo/internal/imports"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxImportSize caps an uploaded export; Umami dumps of busy sites are
+// the largest.
+const maxImportSize = 1 << 30
+
+type ImportHandler struct {
+	DB *gorm.DB
+	// Dir holds the uploads until the import job has processed them.
+	Dir string
+}
+
+func NewImportHandler(db *gorm.DB, dir string) *ImportHandler {
+	return &ImportHandler{DB: db, Dir: dir}
+}
+
+// GET /projects/{id}/imports
+func (h *ImportHandler) ListImports(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var list []models.Import
+	if err := h.DB.Where("project_id = ?", projectID).Order("created_at DESC").Find(&list).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve imports")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, list)
+}
+
+// GET /projects/{id}/imports/{importId}
+func (h *ImportHandler) GetImport(w http.ResponseWriter, r *http.Request) {
+	imp, ok := h.findImport(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, imp)
+}
+
+// POST /projects/{id}/imports
+//
+// Takes a multipart upload with the export in "file", its "source"
+// (plausible, umami or ga4) and, for Umami exports holding several
+// websites, the "website_id" to import. The file is processed in the
+// background; uploading a file already imported into the project returns
+// that import instead.
+func (h *ImportHandler) CreateImport(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	userID, _ := r.Context().Value(models.UserIDKey).(uuid.UUID)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Expected a multipart/form-data upload")
+		return
+	}
+	if err := os.MkdirAll(h.Dir, 0o750); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to store the upload")
+		return
+	}
+
+	// The upload is removed unless an import takes it over.
+	var source, websiteID, fileName, filePath, fileHash string
+	keep := false
+	defer func() {
+		if filePath != "" && !keep {
+			os.Remove(filePath)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+
+		switch part.FormName() {
+		case "source":
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			if err != nil {
+				writeUploadError(w, err)
+				return
+			}
+			source = strings.ToLower(strings.TrimSpace(string(value)))
+		case "website_id":
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			if err != nil {
+				writeUploadError(w, err)
+				return
+			}
+			websiteID = strings.TrimSpace(string(value))
+		case "file":
+			if filePath != "" {
+				utils.WriteError(w, http.StatusBadRequest, "Only one file per import")
+				return
+			}
+			fileName = filepath.Base(part.FileName())
+			filePath, fileHash, err = h.saveUpload(part)
+			if err != nil {
+				writeUploadError(w, err)
+				return
+			}
+		}
+		part.Close()
+	}
+
+	switch models.ImportSource(source) {
+	case models.ImportPlausible, models.ImportUmami, models.ImportGA4:
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid source, expected plausible, umami or ga4")
+		return
+	}
+	if filePath == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Missing file")
+		return
+	}
+
+	var existing models.Import
+	err = h.DB.Where("project_id = ? AND file_hash = ? AND website_id = ? AND status IN ?",
+		projectID, fileHash, websiteID,
+		[]models.ImportStatus{models.ImportPending, models.ImportRunning, models.ImportCompleted}).
+		Order("created_at DESC").First(&existing).Error
+	if err == nil {
+		utils.WriteJSON(w, http.StatusOK, existing)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to check earlier imports")
+		return
+	}
+
+	imp := models.Import{
+		ID:        uuid.New(),
+		ProjectID: projectID,
+		Source:    models.ImportSource(source),
+		FileName:  fileName,
+		FileHash:  fileHash,
+		FilePath:  filePath,
+		WebsiteID: websiteID,
+		Status:    models.ImportPending,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	if err := h.DB.Create(&imp).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during creation")
+		return
+	}
+	keep = true
+
+	utils.WriteJSON(w, http.StatusAccepted, imp)
+}
+
+// DELETE /projects/{id}/imports/{importId}
+//
+// Rolls the import back, deleting everything it brought in. A pending
+// import is cancelled; a running one has to finish first.
+func (h *ImportHandler) RollbackImport(w http.ResponseWriter, r *http.Request) {
+	imp, ok := h.findImport(w, r)
+	if !ok {
+		return
+	}
+
+	switch imp.Status {
+	case models.ImportRunning:
+		utils.WriteError(w, http.StatusConflict, "Import is running, roll it back once it is done")
+		return
+	case models.ImportRolledBack:
+		utils.WriteJSON(w, http.StatusOK, imp)
+		return
+	case models.ImportPending:
+		// The job may claim it in the meantime.
+		result := h.DB.Model(&models.Import{}).
+			Where("id = ? AND status = ?", imp.ID, models.ImportPending).
+			Updates(map[string]interface{}{"status": models.ImportRolledBack, "file_path": ""})
+		if result.Error != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to cancel import")
+			return
+		}
+		if result.RowsAffected == 0 {
+			utils.WriteError(w, http.StatusConflict, "Import is running, roll it back once it is done")
+			return
+		}
+		if imp.FilePath != "" {
+			os.Remove(imp.FilePath)
+		}
+	default:
+		if err := imports.Rollback(h.DB, imp.ID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to roll back import")
+			return
+		}
+		if err := h.DB.Model(&imp).Update("status", models.ImportRolledBack).Error; err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to roll back import")
+			return
+		}
+	}
+
+	imp.Status, imp.FilePath = models.ImportRolledBack, ""
+	utils.WriteJSON(w, http.StatusOK, imp)
+}
+
+// saveUpload writes an uploaded file to the upload directory, hashing it
+// on the way.
+func (h *ImportHandler) saveUpload(r io.Reader) (string, string, error) {
+	f, err := os.CreateTemp(h.Dir, "import-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	if err := f.Sync(); err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, "File too large, the limit is 1 GB")
+		return
+	}
+	utils.WriteError(w, http.StatusBadRequest, "Invalid upload")
+}
+
+func (h *ImportHandler) findImport(w http.ResponseWriter, r *http.Request) (models.Import, bool) {
+	var imp models.Import
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return imp, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["importId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid import id")
+		return imp, false
+	}
+	if err := h.DB.First(&imp, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Import not found")
+		return imp, false
+	}
+	return imp, true
+}
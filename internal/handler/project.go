@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"jiramo/internal/analytics"
 	"jiramo/internal/models"
 	"jiramo/internal/utils"
 	"net/http"
@@ -22,16 +23,26 @@ func NewProjectHandler(db *gorm.DB) *ProjectHandler {
 	return &ProjectHandler{DB: db, Validate: validator.New()}
 }
 
+const allowedOriginsRules = "max=50,dive,min=1,max=255"
+
 type ProjectInput struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	CustomerId  string `json:"customer_id"`
+	Title          string   `json:"title"`
+	Description    string   `json:"description"`
+	CustomerId     string   `json:"customer_id"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	RetentionDays  int      `json:"retention_days"`
+	RespectDNT     bool     `json:"respect_dnt"`
+	ExcludedIPs    []string `json:"excluded_ips"`
 }
 
 type UpdateProjectInput struct {
-	Title       *string `json:"title" validate:"omitempty,min=3,max=32"`
-	Description *string `json:"description" validate:"omitempty,min=1,max=64"`
-	CustomerId  *string `json:"customer_id" validate:"omitempty,uuid"`
+	Title          *string   `json:"title" validate:"omitempty,min=3,max=32"`
+	Description    *string   `json:"description" validate:"omitempty,min=1,max=64"`
+	CustomerId     *string   `json:"customer_id" validate:"omitempty,uuid"`
+	AllowedOrigins *[]string `json:"allowed_origins"`
+	RetentionDays  *int      `json:"retention_days"`
+	RespectDNT     *bool     `json:"respect_dnt"`
+	ExcludedIPs    *[]string `json:"excluded_ips"`
 }
 
 func (h *ProjectHandler) GetProjects(w http.ResponseWriter, r *http.Request) {
@@ -67,17 +78,36 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.Validate.Var(input.AllowedOrigins, allowedOriginsRules); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid allowed_origins")
+		return
+	}
+
+	if !validRetentionDays(input.RetentionDays) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid retention_days")
+		return
+	}
+
+	if !validExcludedIPs(input.ExcludedIPs) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid excluded_ips")
+		return
+	}
+
 	customerUUID, success := h.validateCustomer(w, input.CustomerId)
 	if !success {
 		return
 	}
 
 	project := models.Project{
-		ID:          uuid.New(),
-		Title:       input.Title,
-		Description: input.Description,
-		CustomerID:  customerUUID,
-		Status:      false,
+		ID:             uuid.New(),
+		Title:          input.Title,
+		Description:    input.Description,
+		CustomerID:     customerUUID,
+		Status:         false,
+		AllowedOrigins: models.StringList(input.AllowedOrigins),
+		RetentionDays:  input.RetentionDays,
+		RespectDNT:     input.RespectDNT,
+		ExcludedIPs:    models.StringList(input.ExcludedIPs),
 	}
 
 	if err := h.DB.Create(&project).Error; err != nil {
@@ -116,6 +146,30 @@ func (h *ProjectHandler) EditProject(w http.ResponseWriter, r *http.Request) {
 		}
 		updates["customer_id"] = customerUUID
 	}
+	if input.AllowedOrigins != nil {
+		if err := h.Validate.Var(*input.AllowedOrigins, allowedOriginsRules); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid allowed_origins")
+			return
+		}
+		updates["allowed_origins"] = models.StringList(*input.AllowedOrigins)
+	}
+	if input.RetentionDays != nil {
+		if !validRetentionDays(*input.RetentionDays) {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid retention_days")
+			return
+		}
+		updates["retention_days"] = *input.RetentionDays
+	}
+	if input.RespectDNT != nil {
+		updates["respect_dnt"] = *input.RespectDNT
+	}
+	if input.ExcludedIPs != nil {
+		if !validExcludedIPs(*input.ExcludedIPs) {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid excluded_ips")
+			return
+		}
+		updates["excluded_ips"] = models.StringList(*input.ExcludedIPs)
+	}
 
 	if err := h.DB.Model(&models.Project{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Error during update")
@@ -215,3 +269,22 @@ func (h *ProjectHandler) validateCustomer(w http.ResponseWriter, customerIdStr s
 	}
 	return customerUUID, true
 }
+
+// validRetentionDays accepts zero (use the global default) or a period long
+// enough for rollups to be final before raw rows are pruned.
+func validRetentionDays(days int) bool {
+	return days == 0 || (days >= analytics.MinRetentionDays && days <= 3650)
+}
+
+// validExcludedIPs accepts up to 100 IP addresses or CIDR ranges.
+func validExcludedIPs(entries []string) bool {
+	if len(entries) > 100 {
+		return false
+	}
+	for _, entry := range entries {
+		if !utils.ValidIPOrCIDR(entry) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"jiramo/internal/models"
+	"jiramo/internal/notify"
+	"jiramo/internal/reports"
+	"jiramo/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type ReportHandler struct {
+	DB       *gorm.DB
+	Validate *validator.Validate
+	// Mailer is nil when SMTP is not configured.
+	Mailer *notify.SMTP
+}
+
+func NewReportHandler(db *gorm.DB, mailer *notify.SMTP) *ReportHandler {
+	return &ReportHandler{DB: db, Validate: validator.New(), Mailer: mailer}
+}
+
+type ReportSubscriptionInput struct {
+	Recipients []string               `json:"recipients" validate:"required,min=1,max=20,dive,email"`
+	Frequency  models.ReportFrequency `json:"frequency" validate:"required,oneof=daily weekly monthly"`
+	Timezone   string                 `json:"timezone" validate:"max=64"`
+}
+
+type UpdateReportSubscriptionInput struct {
+	Recipients []string                `json:"recipients" validate:"omitempty,min=1,max=20,dive,email"`
+	Frequency  *models.ReportFrequency `json:"frequency" validate:"omitempty,oneof=daily weekly monthly"`
+	Timezone   *string                 `json:"timezone" validate:"omitempty,max=64"`
+	Enabled    *bool                   `json:"enabled"`
+}
+
+// GET /projects/{id}/reports
+func (h *ReportHandler) ListReportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var subs []models.ReportSubscription
+	if err := h.DB.Where("project_id = ?", projectID).Order("created_at").Find(&subs).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve report subscriptions")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, subs)
+}
+
+// POST /projects/{id}/reports
+func (h *ReportHandler) CreateReportSubscription(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.DB.First(&models.Project{}, "id = ?", projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	var input ReportSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := h.Validate.Struct(input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(input.Timezone)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid timezone")
+		return
+	}
+
+	now := time.Now()
+	sub := models.ReportSubscription{
+		ID:         uuid.New(),
+		ProjectID:  projectID,
+		Recipients: input.Recipients,
+		Frequency:  input.Frequency,
+		Timezone:   input.Timezone,
+		Enabled:    true,
+		NextRunAt:  reports.NextRun(input.Frequency, loc, now),
+		CreatedAt:  now,
+	}
+
+	if err := h.DB.Create(&sub).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during creation")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, sub)
+}
+
+// PATCH /projects/{id}/reports/{reportId}
+func (h *ReportHandler) UpdateReportSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.findSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	var input UpdateReportSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := h.Validate.Struct(input); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.Recipients != nil {
+		sub.Recipients = input.Recipients
+	}
+	if input.Frequency != nil {
+		sub.Frequency = *input.Frequency
+	}
+	if input.Timezone != nil {
+		sub.Timezone = *input.Timezone
+	}
+	if input.Enabled != nil {
+		sub.Enabled = *input.Enabled
+	}
+
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid timezone")
+		return
+	}
+	if input.Frequency != nil || input.Timezone != nil {
+		sub.NextRunAt = reports.NextRun(sub.Frequency, loc, time.Now())
+	}
+
+	err = h.DB.Model(&models.ReportSubscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"recipients":  sub.Recipients,
+		"frequency":   sub.Frequency,
+		"timezone":    sub.Timezone,
+		"enabled":     sub.Enabled,
+		"next_run_at": sub.NextRunAt,
+	}).Error
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Error during update")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, sub)
+}
+
+// DELETE /projects/{id}/reports/{reportId}
+func (h *ReportHandler) DeleteReportSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.findSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(&sub).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete report subscription")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /projects/{id}/reports/{reportId}/preview
+//
+// Renders the email the subscription would receive if it ran now.
+func (h *ReportHandler) PreviewReport(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.findSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := reports.ForSubscription(h.DB, sub, time.Now())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not build report")
+		return
+	}
+	body, err := report.Render()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Could not render report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body))
+}
+
+// POST /projects/{id}/reports/{reportId}/send
+//
+// Sends the report right away without changing the schedule.
+func (h *ReportHandler) SendReport(w http.ResponseWriter, r *http.Request) {
+	if h.Mailer == nil {
+		utils.WriteError(w, http.StatusServiceUnavailable, "Email is not configured, set SMTP_HOST")
+		return
+	}
+	sub, ok := h.findSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	if err := reports.Send(ctx, h.DB, h.Mailer, sub, time.Now()); err != nil {
+		utils.WriteError(w, http.StatusBadGateway, "Report failed: "+err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Report sent"})
+}
+
+func (h *ReportHandler) findSubscription(w http.ResponseWriter, r *http.Request) (models.ReportSubscription, bool) {
+	var sub models.ReportSubscription
+	projectID, ok := projectIDFromRequest(w, r)
+	if !ok {
+		return sub, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["reportId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid report id")
+		return sub, false
+	}
+	if err := h.DB.Preload("Project").First(&sub, "id = ? AND project_id = ?", id, projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Report subscription not found")
+		return sub, false
+	}
+	return sub, true
+}
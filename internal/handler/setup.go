@@ -22,10 +22,16 @@ type SetupHandler struct {
 }
 
 type HandlerRegistry struct {
-	Auth    *AuthHandler
-	Project *ProjectHandler
-	User    *UserHandler
-	Profile *ProfileHandler
+	Auth      *AuthHandler
+	Project   *ProjectHandler
+	User      *UserHandler
+	Profile   *ProfileHandler
+	Analytics *AnalyticsHandler
+	APIKey    *APIKeyHandler
+	Goal      *GoalHandler
+	Alert     *AlertHandler
+	Report    *ReportHandler
+	Import    *ImportHandler
 }
 
 func NewSetupHandler(db *gorm.DB) *SetupHandler {
@@ -141,6 +147,25 @@ func (h *SetupHandler) DBSetup(w http.ResponseWriter, r *http.Request) {
 	if h.HandlerRefs.Profile != nil {
 		h.HandlerRefs.Profile.DB = dbConn
 	}
+	if h.HandlerRefs.Analytics != nil {
+		h.HandlerRefs.Analytics.DB = dbConn
+		h.HandlerRefs.Analytics.Ingest.SetDB(dbConn)
+	}
+	if h.HandlerRefs.APIKey != nil {
+		h.HandlerRefs.APIKey.DB = dbConn
+	}
+	if h.HandlerRefs.Goal != nil {
+		h.HandlerRefs.Goal.DB = dbConn
+	}
+	if h.HandlerRefs.Alert != nil {
+		h.HandlerRefs.Alert.DB = dbConn
+	}
+	if h.HandlerRefs.Report != nil {
+		h.HandlerRefs.Report.DB = dbConn
+	}
+	if h.HandlerRefs.Import != nil {
+		h.HandlerRefs.Import.DB = dbConn
+	}
 
 	// Check if admin exists (setup might have been done before)
 	exists, errCheck := db.AdminExists(dbConn)
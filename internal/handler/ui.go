@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"bytes"
 	"io/fs"
 	"jiramo/internal/config"
 	"jiramo/web"
@@ -10,12 +11,14 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 type WebHandler struct {
 	FrontendURL string
 	Env         string
 	FS          fs.FS
+	Tracker     []byte
 }
 
 func NewWebHandler() *WebHandler {
@@ -28,6 +31,7 @@ func NewWebHandler() *WebHandler {
 		FrontendURL: config.Global.FRONTEND_URL,
 		Env:         os.Getenv("APP_ENV"),
 		FS:          embeddedFS,
+		Tracker:     web.Tracker(),
 	}
 }
 
@@ -49,3 +53,14 @@ func (h *WebHandler) UIHandler() http.Handler {
 		fs.ServeHTTP(w, r)
 	})
 }
+
+func (h *WebHandler) TrackerHandler() http.Handler {
+	modTime := time.Now()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		http.ServeContent(w, r, "script.js", modTime, bytes.NewReader(h.Tracker))
+	})
+}
@@ -0,0 +1,183 @@
+package imports
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"jiramo/internal/analytics"
+	"jiramo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// totals are the metrics of a day, or of a dimension value on a day, as
+// the rollups hold them.
+type totals struct {
+	Views    int64
+	Visitors int64
+	Sessions int64
+	Bounces  int64
+	Duration int64
+}
+
+func (t *totals) add(o totals) {
+	t.Views += o.Views
+	t.Visitors += o.Visitors
+	t.Sessions += o.Sessions
+	t.Bounces += o.Bounces
+	t.Duration += o.Duration
+}
+
+type dimensionKey struct {
+	day       int64
+	dimension string
+	value     string
+}
+
+// aggregate collects the daily totals and dimension values of an export
+// that only has daily aggregates. Rows repeating a day, or a value of a
+// day, are summed.
+type aggregate struct {
+	days       map[int64]*totals
+	dimensions map[dimensionKey]*totals
+}
+
+func newAggregate() *aggregate {
+	return &aggregate{
+		days:       map[int64]*totals{},
+		dimensions: map[dimensionKey]*totals{},
+	}
+}
+
+func (a *aggregate) addDay(d time.Time, t totals) {
+	key := d.UTC().Truncate(day).Unix()
+	if a.days[key] == nil {
+		a.days[key] = &totals{}
+	}
+	a.days[key].add(t)
+}
+
+func (a *aggregate) addDimension(d time.Time, dimension, value string, t totals) {
+	key := dimensionKey{d.UTC().Truncate(day).Unix(), dimension, value}
+	if a.dimensions[key] == nil {
+		a.dimensions[key] = &totals{}
+	}
+	a.dimensions[key].add(t)
+}
+
+// writeAggregate stores the days of agg the project has no data for as
+// daily rollups, keeping the top values of each dimension like the rollup
+// job does.
+func writeAggregate(ctx context.Context, db *gorm.DB, imp *models.Import, agg *aggregate, cov coverage) error {
+	written := map[int64]bool{}
+	skipped := map[int64]bool{}
+	keep := func(key int64) bool {
+		if written[key] {
+			return true
+		}
+		if skipped[key] || cov.covered(time.Unix(key, 0)) {
+			skipped[key] = true
+			return false
+		}
+		written[key] = true
+		return true
+	}
+
+	var rollups []models.Rollup
+	for key, t := range agg.days {
+		if !keep(key) {
+			continue
+		}
+		rollups = append(rollups, models.Rollup{
+			ProjectID:   imp.ProjectID,
+			Granularity: models.RollupDay,
+			Bucket:      time.Unix(key, 0).UTC(),
+			Views:       t.Views,
+			Visitors:    t.Visitors,
+			Sessions:    t.Sessions,
+			Bounces:     t.Bounces,
+			Duration:    t.Duration,
+			UpdatedAt:   time.Now(),
+			ImportID:    &imp.ID,
+		})
+	}
+
+	type group struct {
+		day       int64
+		dimension string
+	}
+	groups := map[group][]models.DimensionRollup{}
+	for key, t := range agg.dimensions {
+		if !keep(key.day) {
+			continue
+		}
+		g := group{key.day, key.dimension}
+		groups[g] = append(groups[g], models.DimensionRollup{
+			ProjectID: imp.ProjectID,
+			Bucket:    time.Unix(key.day, 0).UTC(),
+			Dimension: key.dimension,
+			Value:     key.value,
+			Views:     t.Views,
+			Visitors:  t.Visitors,
+			Sessions:  t.Sessions,
+			Bounces:   t.Bounces,
+			Duration:  t.Duration,
+			ImportID:  &imp.ID,
+		})
+	}
+	var dimensions []models.DimensionRollup
+	for _, rows := range groups {
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].Visitors != rows[j].Visitors {
+				return rows[i].Visitors > rows[j].Visitors
+			}
+			return rows[i].Views > rows[j].Views
+		})
+		if len(rows) > analytics.TopDimensionValues {
+			rows = rows[:analytics.TopDimensionValues]
+		}
+		dimensions = append(dimensions, rows...)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(rollups) > 0 {
+			if err := tx.CreateInBatches(rollups, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(dimensions) > 0 {
+			if err := tx.CreateInBatches(dimensions, 500).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	imp.Skipped = int64(len(skipped))
+	recordDays(imp, written)
+	return nil
+}
+
+// recordDays sets the import's day count and range from the days written,
+// keyed by Unix time.
+func recordDays(imp *models.Import, written map[int64]bool) {
+	imp.Days = int64(len(written))
+	for key := range written {
+		d := time.Unix(key, 0).UTC()
+		if imp.FirstDay == nil || d.Before(*imp.FirstDay) {
+			first := d
+			imp.FirstDay = &first
+		}
+		if imp.LastDay == nil || d.After(*imp.LastDay) {
+			last := d
+			imp.LastDay = &last
+		}
+	}
+}
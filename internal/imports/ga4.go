@@ -0,0 +1,160 @@
+package imports
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ga4Dimensions maps the dimension columns of a GA4 report to the
+// dimension they fill.
+var ga4Dimensions = map[string]string{
+	"page path and screen class": "page",
+	"page path":                  "page",
+	"landing page":               "page",
+	"hostname":                   "hostname",
+	"browser":                    "browser",
+	"operating system":           "os",
+	"device category":            "device",
+	"country id":                 "country",
+	"language code":              "language",
+	"session source":             "utm_source",
+	"session medium":             "utm_medium",
+	"session campaign":           "utm_campaign",
+}
+
+// ga4Metrics lists, for each rollup metric, the GA4 columns it may be read
+// from, in order of preference.
+var (
+	ga4Visitors = []string{"total users", "active users", "users"}
+	ga4Views    = []string{"views", "screen page views", "page views"}
+	ga4Sessions = []string{"sessions"}
+)
+
+// readGA4 reads GA4 reports downloaded as CSV from the Reports section or
+// an exploration, zipped or one at a time. Each report needs a Date column
+// and may have one of the ga4Dimensions; without one it gives the daily
+// totals.
+func readGA4(files []sourceFile, p *progress) (*aggregate, error) {
+	agg := newAggregate()
+	for _, f := range files {
+		p.total += f.Size
+	}
+
+	found := false
+	for _, f := range files {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".csv") {
+			p.add(int(f.Size))
+			continue
+		}
+		found = true
+		if err := readGA4Report(f, p, agg); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	if !found {
+		return nil, errors.New("no CSV report found")
+	}
+	return agg, nil
+}
+
+func readGA4Report(f sourceFile, p *progress, agg *aggregate) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	t, err := newCSVTable(p.reader(rc))
+	if err != nil {
+		return err
+	}
+	if !t.has("date") {
+		return errors.New("missing Date column, add the Date dimension to the report")
+	}
+
+	column, dimension := "", ""
+	for name, d := range ga4Dimensions {
+		if !t.has(name) {
+			continue
+		}
+		if dimension != "" && d != dimension {
+			return errors.New("more than one dimension besides Date")
+		}
+		column, dimension = name, d
+	}
+
+	visitors, views, sessions := firstColumn(t, ga4Visitors), firstColumn(t, ga4Views), firstColumn(t, ga4Sessions)
+	if visitors == "" && views == "" && sessions == "" {
+		return errors.New("no Users, Views or Sessions column")
+	}
+
+	for {
+		row, err := t.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Totals rows and blank lines have no date.
+		d, err := time.Parse("20060102", t.get(row, "date"))
+		if err != nil {
+			continue
+		}
+
+		metrics := totals{
+			Visitors: t.number(row, visitors),
+			Views:    t.number(row, views),
+			Sessions: t.number(row, sessions),
+		}
+		switch {
+		case t.has("engaged sessions"):
+			// GA4 counts a session as a bounce when it was not engaged.
+			metrics.Bounces = metrics.Sessions - t.number(row, "engaged sessions")
+		case t.has("bounce rate"):
+			metrics.Bounces = int64(t.float(row, "bounce rate")*float64(metrics.Sessions) + 0.5)
+		}
+		if metrics.Bounces < 0 {
+			metrics.Bounces = 0
+		}
+		switch {
+		case t.has("user engagement"):
+			metrics.Duration = t.number(row, "user engagement")
+		case t.has("average session duration"):
+			metrics.Duration = int64(t.float(row, "average session duration")*float64(metrics.Sessions) + 0.5)
+		}
+
+		if dimension == "" {
+			agg.addDay(d, metrics)
+			continue
+		}
+		value := t.get(row, column)
+		if value == "(not set)" || value == "(direct)" || value == "(none)" {
+			value = ""
+		}
+		switch dimension {
+		case "browser":
+			value = mapName(browserNames, value)
+		case "os":
+			value = mapName(osNames, value)
+		case "device", "utm_source", "utm_medium":
+			value = strings.ToLower(value)
+		case "country":
+			value = strings.ToUpper(value)
+		}
+		agg.addDimension(d, dimension, value, metrics)
+	}
+}
+
+func firstColumn(t *table, names []string) string {
+	for _, name := range names {
+		if t.has(name) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+package imports
+
+import (
+	"context"
+	"time"
+
+	"jiramo/internal/analytics"
+	"jiramo/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const hitBatchSize = 1000
+
+// hitWriter stores per-hit data in batches. Sessions may be handed to it
+// again with every hit: their session_id is derived from the source, and
+// one already stored is left as is.
+type hitWriter struct {
+	ctx context.Context
+	db  *gorm.DB
+	imp *models.Import
+	cov coverage
+
+	sessions []models.Session
+	queued   map[string]bool
+	views    []models.PageView
+	events   []models.AnalyticsEvent
+
+	// days holds the days written, by Unix time.
+	days map[int64]bool
+}
+
+func newHitWriter(ctx context.Context, db *gorm.DB, imp *models.Import, cov coverage) *hitWriter {
+	return &hitWriter{
+		ctx:    ctx,
+		db:     db,
+		imp:    imp,
+		cov:    cov,
+		queued: map[string]bool{},
+		days:   map[int64]bool{},
+	}
+}
+
+// keep reports whether a hit at t may be imported, counting it as skipped
+// when its day already has data.
+func (w *hitWriter) keep(t time.Time) bool {
+	if w.cov.covered(t) {
+		w.imp.Skipped++
+		return false
+	}
+	w.days[t.UTC().Truncate(day).Unix()] = true
+	return true
+}
+
+func (w *hitWriter) addSession(s models.Session) {
+	if w.queued[s.SessionID] {
+		return
+	}
+	w.queued[s.SessionID] = true
+	s.ImportID = &w.imp.ID
+	w.sessions = append(w.sessions, s)
+}
+
+func (w *hitWriter) addView(v models.PageView) error {
+	v.ImportID = &w.imp.ID
+	w.views = append(w.views, v)
+	return w.flushIfFull()
+}
+
+func (w *hitWriter) addEvent(e models.AnalyticsEvent) error {
+	e.ImportID = &w.imp.ID
+	w.events = append(w.events, e)
+	return w.flushIfFull()
+}
+
+func (w *hitWriter) flushIfFull() error {
+	if len(w.views)+len(w.events) < hitBatchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *hitWriter) flush() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if len(w.sessions) > 0 {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(w.sessions, hitBatchSize)
+			if result.Error != nil {
+				return result.Error
+			}
+			w.imp.Sessions += result.RowsAffected
+		}
+		if len(w.views) > 0 {
+			if err := tx.CreateInBatches(w.views, hitBatchSize).Error; err != nil {
+				return err
+			}
+			w.imp.PageViews += int64(len(w.views))
+		}
+		if len(w.events) > 0 {
+			if err := tx.CreateInBatches(w.events, hitBatchSize).Error; err != nil {
+				return err
+			}
+			w.imp.Events += int64(len(w.events))
+		}
+
+		w.sessions, w.views, w.events = w.sessions[:0], w.views[:0], w.events[:0]
+		w.queued = map[string]bool{}
+		return nil
+	})
+}
+
+// finish writes what is left, derives the page view durations from the
+// next view of each session, and aggregates the imported days into the
+// rollups, tagged with the import.
+func (w *hitWriter) finish() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	err := w.db.Exec(`
+		UPDATE page_views pv SET duration = next.duration
+		FROM (
+			SELECT id, CAST(EXTRACT(EPOCH FROM (
+				lead(created_at) OVER (PARTITION BY session_id ORDER BY created_at) - created_at
+			)) AS integer) AS duration
+			FROM page_views
+			WHERE import_id = ?
+		) next
+		WHERE pv.id = next.id AND next.duration IS NOT NULL`, w.imp.ID).Error
+	if err != nil {
+		return err
+	}
+
+	for key := range w.days {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		d := time.Unix(key, 0).UTC()
+		if err := analytics.RollupDay(w.db, w.imp.ProjectID, d); err != nil {
+			return err
+		}
+		err := w.db.Exec(`
+			UPDATE rollups SET import_id = ?
+			WHERE project_id = ? AND bucket >= ? AND bucket < ?`,
+			w.imp.ID, w.imp.ProjectID, d, d.Add(day)).Error
+		if err != nil {
+			return err
+		}
+		err = w.db.Exec(`
+			UPDATE dimension_rollups SET import_id = ?
+			WHERE project_id = ? AND bucket = ?`,
+			w.imp.ID, w.imp.ProjectID, d).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	recordDays(w.imp, w.days)
+	return nil
+}
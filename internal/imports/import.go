@@ -0,0 +1,351 @@
+// Package imports brings the history of other analytics tools into a
+// project: Plausible CSV exports, Umami database dumps and CSVs, and GA4
+// CSV reports. Per-hit data becomes sessions, page views and events; daily
+// aggregates go straight into the rollups. Every row written is tagged with
+// the import so that it can be rolled back.
+package imports
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiramo/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	day = 24 * time.Hour
+
+	// readShare is the part of the progress given to reading the file; the
+	// rest covers writing and aggregating.
+	readShare = 90
+)
+
+// process reads the import's file and writes what it holds, filling in
+// the import's counters.
+func process(ctx context.Context, db *gorm.DB, imp *models.Import) error {
+	f, err := os.Open(imp.FilePath)
+	if err != nil {
+		return fmt.Errorf("could not open the uploaded file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	cov, err := loadCoverage(db, imp.ProjectID)
+	if err != nil {
+		return err
+	}
+	p := &progress{ctx: ctx, db: db, id: imp.ID}
+
+	switch imp.Source {
+	case models.ImportPlausible, models.ImportGA4:
+		files, err := openFiles(f, info.Size(), imp.FileName)
+		if err != nil {
+			return err
+		}
+		read := readPlausible
+		if imp.Source == models.ImportGA4 {
+			read = readGA4
+		}
+		agg, err := read(files, p)
+		if err != nil {
+			return err
+		}
+		return writeAggregate(ctx, db, imp, agg, cov)
+
+	case models.ImportUmami:
+		w := newHitWriter(ctx, db, imp, cov)
+		if err := readUmami(f, info.Size(), imp, p, w); err != nil {
+			return err
+		}
+		return w.finish()
+
+	default:
+		return fmt.Errorf("unknown source %q", imp.Source)
+	}
+}
+
+// progress records the share of the file read so far, at most once a
+// second. Reading through it also stops an import whose context is done.
+type progress struct {
+	ctx     context.Context
+	db      *gorm.DB
+	id      uuid.UUID
+	total   int64
+	read    int64
+	percent int
+	saved   time.Time
+}
+
+func (p *progress) reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+func (p *progress) add(n int) {
+	p.read += int64(n)
+	if p.total <= 0 {
+		return
+	}
+	percent := int(p.read * readShare / p.total)
+	if percent > readShare {
+		percent = readShare
+	}
+	if percent == p.percent || time.Since(p.saved) < time.Second {
+		return
+	}
+	p.percent, p.saved = percent, time.Now()
+	p.db.Model(&models.Import{}).Where("id = ?", p.id).Update("progress", percent)
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	if err := pr.p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := pr.r.Read(b)
+	pr.p.add(n)
+	return n, err
+}
+
+// coverage tells which days of a project already have data. Imports leave
+// those days out so that nothing is counted twice.
+type coverage struct {
+	// since is the first day tracked by jiramo itself; every day from then
+	// on is covered.
+	since time.Time
+	// days holds the days brought in by earlier imports, by Unix time.
+	days map[int64]bool
+}
+
+func loadCoverage(db *gorm.DB, projectID uuid.UUID) (coverage, error) {
+	cov := coverage{days: map[int64]bool{}}
+
+	var since *time.Time
+	err := db.Raw(`
+		SELECT MIN(first_at) FROM (
+			SELECT MIN(created_at) AS first_at FROM page_views WHERE project_id = ? AND import_id IS NULL
+			UNION ALL
+			SELECT MIN(bucket) FROM rollups WHERE project_id = ? AND import_id IS NULL
+		) firsts`, projectID, projectID).Scan(&since).Error
+	if err != nil {
+		return cov, err
+	}
+	if since != nil {
+		cov.since = since.UTC().Truncate(day)
+	}
+
+	var days []time.Time
+	err = db.Raw(`
+		SELECT DISTINCT bucket FROM rollups WHERE project_id = ? AND granularity = 'day' AND import_id IS NOT NULL
+		UNION
+		SELECT DISTINCT bucket FROM dimension_rollups WHERE project_id = ? AND import_id IS NOT NULL`,
+		projectID, projectID).Scan(&days).Error
+	if err != nil {
+		return cov, err
+	}
+	for _, d := range days {
+		cov.days[d.UTC().Truncate(day).Unix()] = true
+	}
+	return cov, nil
+}
+
+func (c coverage) covered(d time.Time) bool {
+	d = d.UTC().Truncate(day)
+	if !c.since.IsZero() && !d.Before(c.since) {
+		return true
+	}
+	return c.days[d.Unix()]
+}
+
+// browserNames and osNames translate the names other tools give browsers
+// and operating systems, lowercased, to those the tracker records.
+var (
+	browserNames = map[string]string{
+		"chrome":          "Chrome",
+		"crios":           "Chrome",
+		"chrome webview":  "Chrome",
+		"edge":            "Edge",
+		"edge-chromium":   "Edge",
+		"edge-ios":        "Edge",
+		"microsoft edge":  "Edge",
+		"firefox":         "Firefox",
+		"fxios":           "Firefox",
+		"mobile firefox":  "Firefox",
+		"safari":          "Safari",
+		"ios":             "Safari",
+		"ios-webview":     "Safari",
+		"mobile safari":   "Safari",
+		"safari (in-app)": "Safari",
+		"opera":           "Opera",
+		"opera-mini":      "Opera",
+		"chromium":        "Chromium",
+	}
+	osNames = map[string]string{
+		"windows":    "Windows",
+		"mac":        "macOS",
+		"mac os":     "macOS",
+		"macintosh":  "macOS",
+		"ios":        "iOS",
+		"android":    "Android",
+		"android os": "Android",
+		"linux":      "Linux",
+		"gnu/linux":  "Linux",
+	}
+)
+
+// mapName translates a browser or OS name with names, falling back to
+// "Other" like the tracker does.
+func mapName(names map[string]string, name string) string {
+	if name == "" {
+		return ""
+	}
+	name = strings.ToLower(name)
+	if mapped, ok := names[name]; ok {
+		return mapped
+	}
+	// Umami names Windows versions, as in "Windows 10".
+	if strings.HasPrefix(name, "windows") {
+		return "Windows"
+	}
+	return "Other"
+}
+
+// sourceFile is one file of an upload: the upload itself, or an entry of
+// an uploaded zip.
+type sourceFile struct {
+	Name string
+	Size int64
+	Open func() (io.ReadCloser, error)
+}
+
+// openFiles lists the files of an upload, unpacking zips.
+func openFiles(f *os.File, size int64, name string) ([]sourceFile, error) {
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if string(magic) != "PK\x03\x04" {
+		return []sourceFile{{
+			Name: name,
+			Size: size,
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(f, 0, size)), nil
+			},
+		}}, nil
+	}
+
+	archive, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file: %w", err)
+	}
+	var files []sourceFile
+	for _, entry := range archive.File {
+		base := path.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		files = append(files, sourceFile{
+			Name: base,
+			Size: int64(entry.UncompressedSize64),
+			Open: entry.Open,
+		})
+	}
+	return files, nil
+}
+
+// table reads the rows of a CSV file or of a database dump, giving access
+// to columns by name.
+type table struct {
+	columns map[string]int
+	next    func() ([]string, error)
+}
+
+// newCSVTable reads a CSV file whose first row, after any # comment lines,
+// names the columns.
+func newCSVTable(r io.Reader) (*table, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the CSV header: %w", err)
+	}
+	// Excel and Google Sheets start UTF-8 files with a byte order mark.
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = strings.TrimPrefix(name, "\ufeff")
+	}
+	return &table{columns: columnIndex(columns), next: reader.Read}, nil
+}
+
+func columnIndex(names []string) map[string]int {
+	columns := make(map[string]int, len(names))
+	for i, name := range names {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return columns
+}
+
+func (t *table) has(column string) bool {
+	_, ok := t.columns[column]
+	return ok
+}
+
+// get returns the value of a column in row, or "" when the table has no
+// such column.
+func (t *table) get(row []string, column string) string {
+	i, ok := t.columns[column]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// number reads a count, tolerating decimals and thousands separators.
+func (t *table) number(row []string, column string) int64 {
+	v := strings.ReplaceAll(t.get(row, column), ",", "")
+	if v == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f + 0.5)
+}
+
+// float reads a decimal value; a trailing % divides it by 100.
+func (t *table) float(row []string, column string) float64 {
+	v := strings.ReplaceAll(t.get(row, column), ",", "")
+	scale := 1.0
+	if strings.HasSuffix(v, "%") {
+		v, scale = strings.TrimSuffix(v, "%"), 0.01
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0
+	}
+	return f * scale
+}
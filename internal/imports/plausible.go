@@ -0,0 +1,158 @@
+package imports
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"jiramo/internal/utils"
+)
+
+// plausibleTables maps the tables of a Plausible CSV export, named after
+// the file's prefix, to the dimension they fill; "" is the daily totals.
+// Entry and exit pages and custom events have no place in the rollups.
+var plausibleTables = []struct {
+	prefix    string
+	dimension string
+}{
+	{"imported_visitors", ""},
+	{"imported_pages", "page"},
+	{"imported_sources", "referrer"},
+	{"imported_browsers", "browser"},
+	{"imported_operating_systems", "os"},
+	{"imported_devices", "device"},
+	{"imported_locations", "country"},
+}
+
+// readPlausible reads the CSV files of a Plausible export, as downloaded
+// from the site settings, zipped or one at a time.
+func readPlausible(files []sourceFile, p *progress) (*aggregate, error) {
+	agg := newAggregate()
+	for _, f := range files {
+		p.total += f.Size
+	}
+
+	found := false
+	for _, f := range files {
+		dimension, ok := plausibleTable(f.Name)
+		if !ok {
+			p.add(int(f.Size))
+			continue
+		}
+		found = true
+		if err := readPlausibleTable(f, dimension, p, agg); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	if !found {
+		return nil, errors.New("no Plausible export file found, expected imported_visitors_*.csv and the like")
+	}
+	return agg, nil
+}
+
+func plausibleTable(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".csv") {
+		return "", false
+	}
+	for _, t := range plausibleTables {
+		if name == t.prefix+".csv" || strings.HasPrefix(name, t.prefix+"_") {
+			return t.dimension, true
+		}
+	}
+	return "", false
+}
+
+func readPlausibleTable(f sourceFile, dimension string, p *progress, agg *aggregate) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	t, err := newCSVTable(p.reader(rc))
+	if err != nil {
+		return err
+	}
+	if !t.has("date") {
+		return errors.New("missing date column")
+	}
+
+	for {
+		row, err := t.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		d, err := time.Parse("2006-01-02", t.get(row, "date"))
+		if err != nil {
+			return fmt.Errorf("invalid date %q", t.get(row, "date"))
+		}
+		metrics := totals{
+			Views:    t.number(row, "pageviews"),
+			Visitors: t.number(row, "visitors"),
+			Sessions: t.number(row, "visits"),
+			Bounces:  t.number(row, "bounces"),
+			Duration: t.number(row, "visit_duration"),
+		}
+
+		switch dimension {
+		case "":
+			agg.addDay(d, metrics)
+		case "page":
+			metrics.Duration = t.number(row, "time_on_page")
+			agg.addDimension(d, "page", t.get(row, "page"), metrics)
+			agg.addDimension(d, "hostname", t.get(row, "hostname"), metrics)
+		case "referrer":
+			referrer := t.get(row, "referrer")
+			utmSource, utmMedium := t.get(row, "utm_source"), t.get(row, "utm_medium")
+			agg.addDimension(d, "referrer", referrerHost(referrer), metrics)
+			agg.addDimension(d, "utm_source", utmSource, metrics)
+			agg.addDimension(d, "utm_medium", utmMedium, metrics)
+			agg.addDimension(d, "utm_campaign", t.get(row, "utm_campaign"), metrics)
+			if utmSource == "" {
+				utmSource = t.get(row, "source")
+				if utmSource == "Direct / None" {
+					utmSource = ""
+				}
+			}
+			agg.addDimension(d, "channel", utils.ClassifyChannel(referrerURL(referrer), "", utmSource, utmMedium), metrics)
+		case "browser":
+			agg.addDimension(d, "browser", mapName(browserNames, t.get(row, "browser")), metrics)
+		case "os":
+			agg.addDimension(d, "os", mapName(osNames, t.get(row, "operating_system")), metrics)
+		case "device":
+			agg.addDimension(d, "device", strings.ToLower(t.get(row, "device")), metrics)
+		case "country":
+			agg.addDimension(d, "country", strings.ToUpper(t.get(row, "country")), metrics)
+		}
+	}
+}
+
+// referrerURL makes a referrer given as a bare domain parseable as a URL.
+func referrerURL(referrer string) string {
+	if referrer == "" || strings.Contains(referrer, "://") {
+		return referrer
+	}
+	return "https://" + referrer
+}
+
+// referrerHost is the referrer dimension's value for a referrer: its host
+// without www.
+func referrerHost(referrer string) string {
+	u, err := url.Parse(referrerURL(referrer))
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	for strings.HasPrefix(host, "www.") {
+		host = strings.TrimPrefix(host, "www.")
+	}
+	return host
+}
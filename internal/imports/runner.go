@@ -0,0 +1,196 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"jiramo/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// taggedTables lists every table an import writes to; their rows carry the
+// import's ID.
+var taggedTables = []string{"page_views", "analytics_events", "sessions", "rollups", "dimension_rollups"}
+
+// Runner processes uploaded imports one at a time in the background.
+type Runner struct {
+	db       func() *gorm.DB
+	interval time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewRunner(db func() *gorm.DB, interval time.Duration) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		db:       db,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *Runner) Start() {
+	go func() {
+		defer close(r.done)
+
+		if err := r.requeue(); err != nil {
+			log.Printf("imports: %v", err)
+		}
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := r.Run(); err != nil {
+				log.Printf("imports: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop interrupts the running import, which is rolled back and resumed on
+// the next start, and waits for the runner to exit.
+func (r *Runner) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Run processes the pending imports, oldest first.
+func (r *Runner) Run() error {
+	db := r.db()
+	if db == nil {
+		return nil
+	}
+
+	for r.ctx.Err() == nil {
+		var imp models.Import
+		err := db.Where("status = ?", models.ImportPending).Order("created_at").First(&imp).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		claimed := db.Model(&models.Import{}).
+			Where("id = ? AND status = ?", imp.ID, models.ImportPending).
+			Updates(map[string]interface{}{"status": models.ImportRunning, "started_at": now})
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			continue
+		}
+		imp.Status, imp.StartedAt = models.ImportRunning, &now
+
+		r.run(db, &imp)
+	}
+	return nil
+}
+
+// run processes one import and records how it ended. Whatever a failed or
+// interrupted import wrote is rolled back.
+func (r *Runner) run(db *gorm.DB, imp *models.Import) {
+	err := process(r.ctx, db, imp)
+
+	if err != nil && r.ctx.Err() != nil {
+		if err := Rollback(db, imp.ID); err != nil {
+			log.Printf("imports: could not roll back interrupted import %s: %v", imp.ID, err)
+		}
+		db.Model(&models.Import{}).Where("id = ?", imp.ID).
+			Updates(map[string]interface{}{"status": models.ImportPending, "progress": 0, "started_at": nil})
+		return
+	}
+
+	now := time.Now()
+	imp.FinishedAt = &now
+	imp.Progress = 100
+	imp.Status = models.ImportCompleted
+	if err != nil {
+		log.Printf("imports: import %s failed: %v", imp.ID, err)
+		if err := Rollback(db, imp.ID); err != nil {
+			log.Printf("imports: could not roll back failed import %s: %v", imp.ID, err)
+		}
+		imp.Status = models.ImportFailed
+		imp.Error = err.Error()
+		imp.Sessions, imp.PageViews, imp.Events, imp.Days, imp.Skipped = 0, 0, 0, 0, 0
+		imp.FirstDay, imp.LastDay = nil, nil
+	}
+
+	if imp.FilePath != "" {
+		if err := os.Remove(imp.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("imports: could not remove %s: %v", imp.FilePath, err)
+		}
+		imp.FilePath = ""
+	}
+
+	err = db.Model(&models.Import{}).Where("id = ?", imp.ID).Updates(map[string]interface{}{
+		"status":      imp.Status,
+		"progress":    imp.Progress,
+		"sessions":    imp.Sessions,
+		"page_views":  imp.PageViews,
+		"events":      imp.Events,
+		"days":        imp.Days,
+		"skipped":     imp.Skipped,
+		"first_day":   imp.FirstDay,
+		"last_day":    imp.LastDay,
+		"error":       imp.Error,
+		"file_path":   imp.FilePath,
+		"finished_at": imp.FinishedAt,
+	}).Error
+	if err != nil {
+		log.Printf("imports: could not record the end of import %s: %v", imp.ID, err)
+	}
+}
+
+// requeue puts back imports left running by a crash, without what they
+// had written so far.
+func (r *Runner) requeue() error {
+	db := r.db()
+	if db == nil {
+		return nil
+	}
+
+	var stale []models.Import
+	if err := db.Where("status = ?", models.ImportRunning).Find(&stale).Error; err != nil {
+		return err
+	}
+	for _, imp := range stale {
+		if err := Rollback(db, imp.ID); err != nil {
+			return err
+		}
+		err := db.Model(&models.Import{}).Where("id = ?", imp.ID).
+			Updates(map[string]interface{}{"status": models.ImportPending, "progress": 0, "started_at": nil}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback deletes everything an import wrote.
+func Rollback(db *gorm.DB, importID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range taggedTables {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE import_id = ?", importID).Error; err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
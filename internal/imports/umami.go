@@ -0,0 +1,462 @@
+package imports
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+
+	"github.com/google/uuid"
+)
+
+// umamiTimeLayouts are the forms created_at takes in Umami exports: as
+// Postgres prints it, as MySQL prints it, and as ISO 8601.
+var umamiTimeLayouts = []string{
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+}
+
+// copyStatement matches the line that starts a table's data in a plain
+// pg_dump, capturing the table and its columns.
+var copyStatement = regexp.MustCompile(`^COPY (?:"?\w+"?\.)?"?(\w+)"? \(([^)]*)\) FROM stdin;$`)
+
+// umamiSession holds what Umami's session table knows about a visitor.
+type umamiSession struct {
+	hostname string
+	browser  string
+	os       string
+	device   string
+	country  string
+	city     string
+	language string
+}
+
+// umamiVisit is the visit an Umami session is in when the export has no
+// visit_id, cut after half an hour without hits like the tracker does.
+type umamiVisit struct {
+	key  string
+	last time.Time
+}
+
+type umamiReader struct {
+	imp *models.Import
+	w   *hitWriter
+
+	website  string
+	sessions map[string]umamiSession
+	visits   map[string]*umamiVisit
+}
+
+// readUmami reads an Umami export: a plain pg_dump of its database, or the
+// CSV files of its tables, zipped or one at a time. Each visit becomes a
+// session; sessions are matched to their visitor by Umami's session_id.
+func readUmami(f *os.File, size int64, imp *models.Import, p *progress, w *hitWriter) error {
+	u := &umamiReader{
+		imp:      imp,
+		w:        w,
+		sessions: map[string]umamiSession{},
+		visits:   map[string]*umamiVisit{},
+	}
+	if strings.HasSuffix(strings.ToLower(imp.FileName), ".sql") {
+		return u.readDump(f, size, p)
+	}
+
+	files, err := openFiles(f, size, imp.FileName)
+	if err != nil {
+		return err
+	}
+	var sessionFiles, eventFiles []sourceFile
+	for _, file := range files {
+		p.total += file.Size
+		kind, err := umamiFileKind(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+		switch kind {
+		case "session":
+			sessionFiles = append(sessionFiles, file)
+		case "website_event":
+			eventFiles = append(eventFiles, file)
+		default:
+			p.add(int(file.Size))
+		}
+	}
+	if len(eventFiles) == 0 {
+		return errors.New("no Umami website_event data found")
+	}
+
+	// Sessions go first so that events find their visitor's attributes.
+	for _, file := range append(sessionFiles, eventFiles...) {
+		if err := u.readFile(file, p); err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// umamiFileKind tells the Umami table a CSV file holds from its columns,
+// or "" for any other file.
+func umamiFileKind(file sourceFile) (string, error) {
+	if !strings.HasSuffix(strings.ToLower(file.Name), ".csv") {
+		return "", nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	t, err := newCSVTable(rc)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case t.has("url_path") && t.has("created_at"):
+		return "website_event", nil
+	case t.has("session_id") && t.has("browser"):
+		return "session", nil
+	}
+	return "", nil
+}
+
+func (u *umamiReader) readFile(file sourceFile, p *progress) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	t, err := newCSVTable(p.reader(rc))
+	if err != nil {
+		return err
+	}
+	if t.has("url_path") {
+		return u.readEvents(t)
+	}
+	return u.readSessions(t)
+}
+
+// readDump reads a plain pg_dump twice: first for the session table, then
+// for the website_event table, which comes before it in the dump.
+func (u *umamiReader) readDump(f *os.File, size int64, p *progress) error {
+	p.total = 2 * size
+
+	sessions, err := dumpTable(p.reader(io.NewSectionReader(f, 0, size)), "session")
+	if err != nil {
+		return err
+	}
+	if sessions != nil {
+		if err := u.readSessions(sessions); err != nil {
+			return fmt.Errorf("session: %w", err)
+		}
+	}
+	p.add(int(size - p.read))
+
+	events, err := dumpTable(p.reader(io.NewSectionReader(f, 0, size)), "website_event")
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		return errors.New("no website_event table in the dump, is it a plain format pg_dump of Umami v2?")
+	}
+	if err := u.readEvents(events); err != nil {
+		return fmt.Errorf("website_event: %w", err)
+	}
+	return nil
+}
+
+// dumpTable finds the data of a table in a plain pg_dump and reads its
+// rows, or returns nil when the dump has no such table.
+func dumpTable(r io.Reader, name string) (*table, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	for {
+		line, err := br.ReadString('\n')
+		if m := copyStatement.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil && m[1] == name {
+			names := strings.Split(m[2], ",")
+			for i, column := range names {
+				names[i] = strings.Trim(strings.TrimSpace(column), `"`)
+			}
+			return &table{columns: columnIndex(names), next: copyRows(br)}, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// copyRows reads the rows of a COPY block in text format, up to its \.
+// line.
+func copyRows(br *bufio.Reader) func() ([]string, error) {
+	return func() ([]string, error) {
+		line, err := br.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == `\.` {
+			return nil, io.EOF
+		}
+		row := strings.Split(line, "\t")
+		for i, value := range row {
+			row[i] = copyValue(value)
+		}
+		return row, nil
+	}
+}
+
+// copyValue undoes the escaping of a value in COPY text format, reading
+// \N, the null value, as empty.
+func copyValue(s string) string {
+	if s == `\N` {
+		return ""
+	}
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// include reports whether a row of the given website belongs to the
+// import. Without a website_id, an export must hold a single website.
+func (u *umamiReader) include(website string) (bool, error) {
+	if u.imp.WebsiteID != "" {
+		return website == "" || strings.EqualFold(website, u.imp.WebsiteID), nil
+	}
+	if website == "" {
+		return true, nil
+	}
+	if u.website == "" {
+		u.website = website
+	}
+	if website != u.website {
+		return false, errors.New("the export holds several websites, pick one with website_id")
+	}
+	return true, nil
+}
+
+func (u *umamiReader) readSessions(t *table) error {
+	for {
+		row, err := t.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ok, err := u.include(t.get(row, "website_id"))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		u.sessions[t.get(row, "session_id")] = umamiSessionFrom(t, row)
+	}
+}
+
+func umamiSessionFrom(t *table, row []string) umamiSession {
+	device := strings.ToLower(t.get(row, "device"))
+	if device == "laptop" {
+		device = "desktop"
+	}
+	return umamiSession{
+		hostname: t.get(row, "hostname"),
+		browser:  mapName(browserNames, t.get(row, "browser")),
+		os:       mapName(osNames, t.get(row, "os")),
+		device:   device,
+		country:  strings.ToUpper(t.get(row, "country")),
+		city:     t.get(row, "city"),
+		language: t.get(row, "language"),
+	}
+}
+
+func (u *umamiReader) readEvents(t *table) error {
+	// Exports from Umami Cloud join the session's columns to each event.
+	inline := t.has("browser")
+	for {
+		row, err := t.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ok, err := u.include(t.get(row, "website_id"))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		created, err := parseUmamiTime(t.get(row, "created_at"))
+		if err != nil {
+			return err
+		}
+		// Exports without event_type only hold page views.
+		eventType := t.get(row, "event_type")
+		if eventType == "" {
+			eventType = "1"
+		}
+		if eventType != "1" && eventType != "2" {
+			continue
+		}
+		if !u.w.keep(created) {
+			continue
+		}
+
+		umamiID := t.get(row, "session_id")
+		attrs := u.sessions[umamiID]
+		if inline {
+			attrs = umamiSessionFrom(t, row)
+		}
+		hostname := t.get(row, "hostname")
+		if hostname == "" {
+			hostname = attrs.hostname
+		}
+
+		rawURL := t.get(row, "url_path")
+		if hostname != "" {
+			rawURL = "https://" + hostname + rawURL
+		}
+		if query := t.get(row, "url_query"); query != "" {
+			rawURL += "?" + query
+		}
+		pageURL, err := url.Parse(rawURL)
+		if err != nil {
+			pageURL = &url.URL{Path: t.get(row, "url_path")}
+		}
+		referrer := ""
+		if domain := t.get(row, "referrer_domain"); domain != "" {
+			referrer = "https://" + domain + t.get(row, "referrer_path")
+			if query := t.get(row, "referrer_query"); query != "" {
+				referrer += "?" + query
+			}
+		}
+
+		visitorID := u.id(umamiID)
+		sessionID := u.id(u.visit(umamiID, t.get(row, "visit_id"), created))
+		utmSource, utmMedium, utmCampaign := utils.ParseUTM(pageURL)
+		u.w.addSession(models.Session{
+			ID:          uuid.New(),
+			ProjectID:   u.imp.ProjectID,
+			VisitorID:   visitorID,
+			SessionID:   sessionID,
+			Hostname:    hostname,
+			Browser:     attrs.browser,
+			OS:          attrs.os,
+			Device:      attrs.device,
+			Country:     attrs.country,
+			City:        attrs.city,
+			Language:    attrs.language,
+			Referrer:    referrer,
+			UTMSource:   utmSource,
+			UTMMedium:   utmMedium,
+			UTMCampaign: utmCampaign,
+			Channel:     utils.ClassifyChannel(referrer, hostname, utmSource, utmMedium),
+			CreatedAt:   created,
+			UpdatedAt:   created,
+			ExpiresAt:   created.Add(utils.SessionTTL),
+		})
+
+		if eventType == "1" {
+			err = u.w.addView(models.PageView{
+				ID:        uuid.New(),
+				ProjectID: u.imp.ProjectID,
+				SessionID: sessionID,
+				VisitorID: visitorID,
+				URL:       pageURL.String(),
+				Path:      pageURL.Path,
+				Referrer:  referrer,
+				Title:     t.get(row, "page_title"),
+				CreatedAt: created,
+			})
+		} else {
+			err = u.w.addEvent(models.AnalyticsEvent{
+				ID:         uuid.New(),
+				ProjectID:  u.imp.ProjectID,
+				SessionID:  sessionID,
+				VisitorID:  visitorID,
+				URL:        pageURL.String(),
+				Path:       pageURL.Path,
+				EventName:  t.get(row, "event_name"),
+				Properties: models.Properties{},
+				CreatedAt:  created,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// visit returns the key of the visit a hit belongs to: Umami's visit_id
+// when the export has one, otherwise the session and the time its visit
+// started, which relies on the hits coming in the order they were made.
+func (u *umamiReader) visit(sessionID, visitID string, created time.Time) string {
+	if visitID != "" {
+		return visitID
+	}
+	v := u.visits[sessionID]
+	if v == nil || created.Sub(v.last) > utils.SessionTTL {
+		v = &umamiVisit{key: sessionID + "|" + strconv.FormatInt(created.Unix(), 10)}
+		u.visits[sessionID] = v
+	}
+	if created.After(v.last) {
+		v.last = created
+	}
+	return v.key
+}
+
+// id derives a stable ID from an Umami one, so that importing the same
+// hits again maps them to the same sessions and visitors.
+func (u *umamiReader) id(key string) string {
+	sum := sha256.Sum256([]byte("umami|" + u.imp.ProjectID.String() + "|" + key))
+	return fmt.Sprintf("%x", sum)
+}
+
+func parseUmamiTime(value string) (time.Time, error) {
+	for _, layout := range umamiTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid created_at %q", value)
+}
@@ -0,0 +1,487 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrQueueFull = errors.New("ingest queue is full")
+	ErrClosed    = errors.New("ingest queue is closed")
+)
+
+// Hit is one unit of tracking work. Every non-nil field is written by the
+// worker that picks it up.
+type Hit struct {
+	NewSession   *models.Session
+	TouchSession string
+	PageView     *models.PageView
+	Event        *models.AnalyticsEvent
+	Vitals       []models.WebVital
+	Error        *ErrorHit
+	ViewDuration *ViewDuration
+	PathDuration *PathDuration
+	Filtered     *Filtered
+}
+
+// ViewDuration closes a page view: its duration becomes EndedAt minus the
+// view's creation time. Views older than an hour are left unchanged.
+type ViewDuration struct {
+	ProjectID string
+	ViewID    string
+	EndedAt   time.Time
+}
+
+// PathDuration sets the duration of the latest view of Path in a session
+// that started around StartedAt, for trackers that do not send view IDs.
+type PathDuration struct {
+	SessionID string
+	Path      string
+	StartedAt time.Time
+	Seconds   int
+}
+
+// ErrorHit is a JavaScript error together with what describes its group.
+// The occurrence's GroupID is filled in when it is written.
+type ErrorHit struct {
+	Occurrence models.ErrorOccurrence
+	Type       string
+	Culprit    string
+}
+
+// Filtered counts a request rejected by the bot and IP filters.
+type Filtered struct {
+	ProjectID uuid.UUID
+	Reason    string
+	At        time.Time
+}
+
+// Queue buffers tracking hits in bounded channels and writes them to the
+// database in batches from a pool of workers. Each worker has a channel of
+// its own, and all the hits of a session go to the same one, so that a
+// session row is written before the page views referring to it.
+type Queue struct {
+	mutex  sync.RWMutex
+	db     *gorm.DB
+	closed bool
+
+	shards        []chan Hit
+	batchSize     int
+	flushInterval time.Duration
+	wg            sync.WaitGroup
+
+	Sessions *SessionCache
+}
+
+func NewQueue(db *gorm.DB, size, workers, batchSize int, flushInterval time.Duration) *Queue {
+	q := &Queue{
+		db:            db,
+		shards:        make([]chan Hit, workers),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+	}
+	q.Sessions = NewSessionCache(q.DB)
+
+	for i := range q.shards {
+		q.shards[i] = make(chan Hit, max(size/workers, 1))
+		q.wg.Add(1)
+		go q.work(q.shards[i])
+	}
+	return q
+}
+
+// DB returns the connection the workers write to.
+func (q *Queue) DB() *gorm.DB {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return q.db
+}
+
+// SetDB swaps the connection, for when the database is configured after
+// startup through the setup wizard.
+func (q *Queue) SetDB(db *gorm.DB) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.db = db
+}
+
+// Enqueue adds a hit without blocking. It returns ErrQueueFull when the
+// buffer is full so callers can shed load. A session the hit would have
+// started is dropped from the session cache.
+func (q *Queue) Enqueue(hit Hit) error {
+	err := q.enqueue(hit)
+	if err != nil && hit.NewSession != nil {
+		q.Sessions.Forget(*hit.NewSession)
+	}
+	return err
+}
+
+func (q *Queue) enqueue(hit Hit) error {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	select {
+	case q.shards[q.shard(hit)] <- hit:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// shard picks the worker of a hit from its session, or from what else
+// identifies it for hits outside any session.
+func (q *Queue) shard(hit Hit) int {
+	var key string
+	switch {
+	case hit.NewSession != nil:
+		key = hit.NewSession.SessionID
+	case hit.TouchSession != "":
+		key = hit.TouchSession
+	case hit.PageView != nil:
+		key = hit.PageView.SessionID
+	case hit.Event != nil:
+		key = hit.Event.SessionID
+	case len(hit.Vitals) > 0:
+		key = hit.Vitals[0].SessionID
+	case hit.Error != nil:
+		key = hit.Error.Occurrence.SessionID
+	case hit.ViewDuration != nil:
+		// Views end long after they are written, whatever the worker.
+		key = hit.ViewDuration.ViewID
+	case hit.Filtered != nil:
+		key = hit.Filtered.ProjectID.String()
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(q.shards)))
+}
+
+// Len reports the number of hits waiting to be written.
+func (q *Queue) Len() int {
+	n := 0
+	for _, shard := range q.shards {
+		n += len(shard)
+	}
+	return n
+}
+
+// Write stores hits in a single transaction, bypassing the queue, for
+// callers that must know whether everything was stored.
+func (q *Queue) Write(hits []Hit) error {
+	db := q.DB()
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return q.write(tx, hits)
+	})
+}
+
+// Close stops accepting hits and waits for the workers to write everything
+// still queued, or for ctx to expire.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		for _, shard := range q.shards {
+			close(shard)
+		}
+	}
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work(hits <-chan Hit) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Hit, 0, q.batchSize)
+	for {
+		select {
+		case hit, ok := <-hits:
+			if !ok {
+				q.flush(batch)
+				return
+			}
+			batch = append(batch, hit)
+			if len(batch) >= q.batchSize {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes a batch in one transaction. A batch that fails is split in
+// halves, in order, until the hits that cannot be written are isolated and
+// dropped, so that one bad row does not lose the rest of the batch.
+func (q *Queue) flush(batch []Hit) {
+	if len(batch) == 0 {
+		return
+	}
+
+	db := q.DB()
+	if db == nil {
+		log.Printf("ingest: dropping %d hits, database not configured", len(batch))
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return q.write(tx, batch)
+	})
+	if err == nil {
+		return
+	}
+	if len(batch) == 1 {
+		log.Printf("ingest: dropping hit: %v", err)
+		if batch[0].NewSession != nil {
+			q.Sessions.Forget(*batch[0].NewSession)
+		}
+		return
+	}
+
+	mid := len(batch) / 2
+	q.flush(batch[:mid])
+	q.flush(batch[mid:])
+}
+
+// write stores every field of the hits of a batch.
+func (q *Queue) write(db *gorm.DB, batch []Hit) error {
+	var (
+		sessions  []models.Session
+		touched   []string
+		views     []models.PageView
+		events    []models.AnalyticsEvent
+		vitals    []models.WebVital
+		errs      []*ErrorHit
+		durations []*ViewDuration
+		paths     []*PathDuration
+	)
+	seen := map[string]bool{}
+	type filteredKey struct {
+		projectID uuid.UUID
+		day       time.Time
+		reason    string
+	}
+	filtered := map[filteredKey]int64{}
+
+	for _, hit := range batch {
+		if hit.NewSession != nil {
+			sessions = append(sessions, *hit.NewSession)
+		}
+		if hit.TouchSession != "" && !seen[hit.TouchSession] {
+			seen[hit.TouchSession] = true
+			touched = append(touched, hit.TouchSession)
+		}
+		if hit.PageView != nil {
+			views = append(views, *hit.PageView)
+		}
+		if hit.Event != nil {
+			events = append(events, *hit.Event)
+		}
+		vitals = append(vitals, hit.Vitals...)
+		if hit.Error != nil {
+			errs = append(errs, hit.Error)
+		}
+		if hit.ViewDuration != nil {
+			durations = append(durations, hit.ViewDuration)
+		}
+		if hit.PathDuration != nil {
+			paths = append(paths, hit.PathDuration)
+		}
+		if f := hit.Filtered; f != nil {
+			filtered[filteredKey{f.ProjectID, f.At.UTC().Truncate(24 * time.Hour), f.Reason}]++
+		}
+	}
+
+	if len(sessions) > 0 {
+		if err := db.CreateInBatches(sessions, q.batchSize).Error; err != nil {
+			return fmt.Errorf("insert %d sessions: %w", len(sessions), err)
+		}
+	}
+
+	if len(touched) > 0 {
+		err := db.Model(&models.Session{}).
+			Where("session_id IN ?", touched).
+			Updates(map[string]interface{}{
+				"expires_at": utils.SessionExpiresAt(),
+				"updated_at": time.Now(),
+			}).Error
+		if err != nil {
+			return fmt.Errorf("extend %d sessions: %w", len(touched), err)
+		}
+	}
+
+	if len(views) > 0 {
+		if err := db.CreateInBatches(views, q.batchSize).Error; err != nil {
+			return fmt.Errorf("insert %d page views: %w", len(views), err)
+		}
+	}
+
+	if len(events) > 0 {
+		if err := db.CreateInBatches(events, q.batchSize).Error; err != nil {
+			return fmt.Errorf("insert %d events: %w", len(events), err)
+		}
+	}
+
+	if len(vitals) > 0 {
+		if err := db.CreateInBatches(vitals, q.batchSize).Error; err != nil {
+			return fmt.Errorf("insert %d web vitals: %w", len(vitals), err)
+		}
+	}
+
+	if len(errs) > 0 {
+		if err := q.writeErrors(db, errs); err != nil {
+			return err
+		}
+	}
+
+	for key, count := range filtered {
+		row := models.FilteredHit{ProjectID: key.projectID, Day: key.day, Reason: key.reason, Count: count}
+		err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "project_id"}, {Name: "day"}, {Name: "reason"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"count": gorm.Expr("filtered_hits.count + EXCLUDED.count"),
+			}),
+		}).Create(&row).Error
+		if err != nil {
+			return fmt.Errorf("count %d filtered hits: %w", count, err)
+		}
+	}
+
+	for _, d := range durations {
+		err := db.Exec(`
+			UPDATE page_views
+			SET duration = CAST(EXTRACT(EPOCH FROM (CAST(? AS timestamptz) - created_at)) AS integer)
+			WHERE id = ? AND project_id = ? AND created_at BETWEEN ? AND ?`,
+			d.EndedAt, d.ViewID, d.ProjectID, d.EndedAt.Add(-time.Hour), d.EndedAt).Error
+		if err != nil {
+			return fmt.Errorf("close view %s: %w", d.ViewID, err)
+		}
+	}
+
+	for _, d := range paths {
+		err := db.Model(&models.PageView{}).
+			Where("session_id = ? AND path = ? AND created_at >= ?",
+				d.SessionID, d.Path, d.StartedAt.Add(-2*time.Second)).
+			Update("duration", d.Seconds).Error
+		if err != nil {
+			return fmt.Errorf("close view of %s: %w", d.Path, err)
+		}
+	}
+	return nil
+}
+
+// writeErrors upserts the group of each error, counting the occurrences and
+// the sessions not seen before, then inserts the occurrences.
+func (q *Queue) writeErrors(db *gorm.DB, errs []*ErrorHit) error {
+	type groupKey struct {
+		projectID   uuid.UUID
+		fingerprint string
+	}
+	groups := map[groupKey][]*ErrorHit{}
+	var order []groupKey
+	for _, e := range errs {
+		key := groupKey{e.Occurrence.ProjectID, e.Occurrence.Fingerprint}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], e)
+	}
+
+	occurrences := make([]models.ErrorOccurrence, 0, len(errs))
+	for _, key := range order {
+		hits := groups[key]
+		first, last := hits[0], hits[len(hits)-1]
+
+		var groupID uuid.UUID
+		err := db.Raw(`
+			INSERT INTO error_groups (id, project_id, fingerprint, type, message, culprit, status, count, sessions, last_release, first_seen_at, last_seen_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?)
+			ON CONFLICT (project_id, fingerprint) DO UPDATE SET
+				count = error_groups.count + EXCLUDED.count,
+				message = EXCLUDED.message,
+				culprit = EXCLUDED.culprit,
+				last_release = COALESCE(NULLIF(EXCLUDED.last_release, ''), error_groups.last_release),
+				last_seen_at = GREATEST(error_groups.last_seen_at, EXCLUDED.last_seen_at),
+				status = CASE WHEN error_groups.status = 'resolved' THEN 'unresolved' ELSE error_groups.status END,
+				resolved_at = CASE WHEN error_groups.status = 'resolved' THEN NULL ELSE error_groups.resolved_at END
+			RETURNING id`,
+			uuid.New(), key.projectID, key.fingerprint, last.Type, last.Occurrence.Message, last.Culprit,
+			models.ErrorUnresolved, len(hits), last.Occurrence.Release,
+			first.Occurrence.CreatedAt, last.Occurrence.CreatedAt).Scan(&groupID).Error
+		if err != nil {
+			return fmt.Errorf("group %d errors: %w", len(hits), err)
+		}
+
+		var sessionIDs []string
+		seen := map[string]bool{}
+		for _, e := range hits {
+			e.Occurrence.GroupID = groupID
+			occurrences = append(occurrences, e.Occurrence)
+			if !seen[e.Occurrence.SessionID] {
+				seen[e.Occurrence.SessionID] = true
+				sessionIDs = append(sessionIDs, e.Occurrence.SessionID)
+			}
+		}
+
+		var known int64
+		err = db.Model(&models.ErrorOccurrence{}).
+			Where("group_id = ? AND session_id IN ?", groupID, sessionIDs).
+			Distinct("session_id").
+			Count(&known).Error
+		if err != nil {
+			return fmt.Errorf("count error sessions: %w", err)
+		}
+		if n := int64(len(sessionIDs)) - known; n > 0 {
+			err := db.Model(&models.ErrorGroup{}).Where("id = ?", groupID).
+				Update("sessions", gorm.Expr("sessions + ?", n)).Error
+			if err != nil {
+				return fmt.Errorf("count error sessions: %w", err)
+			}
+		}
+	}
+
+	if len(occurrences) > 0 {
+		if err := db.CreateInBatches(occurrences, q.batchSize).Error; err != nil {
+			return fmt.Errorf("insert %d errors: %w", len(occurrences), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+const maxCachedSessions = 200000
+
+// SessionCache keeps the active session of each visitor in memory so that
+// tracking a hit does not need a database round trip. On a miss it falls
+// back to the sessions table, which covers restarts.
+type SessionCache struct {
+	mutex    sync.Mutex
+	sessions map[string]models.Session
+	db       func() *gorm.DB
+}
+
+func NewSessionCache(db func() *gorm.DB) *SessionCache {
+	cache := &SessionCache{
+		sessions: make(map[string]models.Session),
+		db:       db,
+	}
+	go cache.cleanup()
+	return cache
+}
+
+// Resolve returns the active session of a visitor, known by any of
+// visitorIDs, and extends it. When there is none and build is not nil, the
+// session returned by build is cached under the first ID and reported as
+// new; with a nil build, found is false.
+func (c *SessionCache) Resolve(projectID string, visitorIDs []string, build func() models.Session) (session models.Session, found, isNew bool, err error) {
+	now := time.Now()
+
+	for _, visitorID := range visitorIDs {
+		if session, ok := c.get(projectID+"|"+visitorID, now); ok {
+			return session, true, false, nil
+		}
+	}
+	key := projectID + "|" + visitorIDs[0]
+
+	db := c.db()
+	if db == nil {
+		return models.Session{}, false, false, gorm.ErrInvalidDB
+	}
+
+	var stored models.Session
+	err = db.
+		Where("visitor_id IN ? AND project_id = ? AND expires_at > ?", visitorIDs, projectID, now).
+		Order("expires_at DESC").
+		First(&stored).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Session{}, false, false, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Another request may have opened the session while we were querying.
+	if cached, ok := c.sessions[key]; ok && cached.ExpiresAt.After(now) {
+		cached.ExpiresAt = utils.SessionExpiresAt()
+		c.sessions[key] = cached
+		return cached, true, false, nil
+	}
+
+	switch {
+	case err == nil:
+		session, found = stored, true
+	case build != nil:
+		session, found, isNew = build(), true, true
+	default:
+		return models.Session{}, false, false, nil
+	}
+
+	session.ExpiresAt = utils.SessionExpiresAt()
+	if len(c.sessions) < maxCachedSessions {
+		c.sessions[key] = session
+	}
+	return session, found, isNew, nil
+}
+
+// Forget drops a session returned as new by Resolve whose row could not be
+// queued, so that the visitor's next hit starts a session again instead of
+// referring to one that was never written.
+func (c *SessionCache) Forget(session models.Session) {
+	key := session.ProjectID.String() + "|" + session.VisitorID
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cached, ok := c.sessions[key]; ok && cached.SessionID == session.SessionID {
+		delete(c.sessions, key)
+	}
+}
+
+func (c *SessionCache) get(key string, now time.Time) (models.Session, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	session, ok := c.sessions[key]
+	if !ok || !session.ExpiresAt.After(now) {
+		return models.Session{}, false
+	}
+	session.ExpiresAt = utils.SessionExpiresAt()
+	c.sessions[key] = session
+	return session, true
+}
+
+func (c *SessionCache) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mutex.Lock()
+		now := time.Now()
+		for k, s := range c.sessions {
+			if !s.ExpiresAt.After(now) {
+				delete(c.sessions, k)
+			}
+		}
+		c.mutex.Unlock()
+	}
+}
@@ -0,0 +1,289 @@
+// Package live fans tracked hits out to dashboards watching a project in
+// real time.
+package live
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ActiveWindow is how long a visitor counts as active after their last
+	// hit, matching the realtime stats endpoint.
+	ActiveWindow = 5 * time.Minute
+
+	subscriberBuffer = 64
+	topPages         = 20
+)
+
+// Hit is a page view or event as shown in the live feed. VisitorID is only
+// used to count active visitors and is never sent to subscribers.
+type Hit struct {
+	Type      string    `json:"type"`
+	VisitorID string    `json:"-"`
+	Path      string    `json:"path"`
+	Title     string    `json:"title,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Referrer  string    `json:"referrer,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	Browser   string    `json:"browser,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	HitPageView = "pageview"
+	HitEvent    = "event"
+)
+
+// Message is one Server-Sent Event: Event is its name and Data is encoded
+// as JSON.
+type Message struct {
+	Event string
+	Data  interface{}
+}
+
+type PageCount struct {
+	Path     string `json:"path"`
+	Visitors int    `json:"visitors"`
+}
+
+type Stats struct {
+	ActiveVisitors int         `json:"active_visitors"`
+	Pages          []PageCount `json:"pages"`
+	AsOf           time.Time   `json:"as_of"`
+}
+
+// Presence is the last known page of a visitor.
+type Presence struct {
+	VisitorID string
+	Path      string
+	Seen      time.Time
+}
+
+type project struct {
+	subscribers map[*Subscription]struct{}
+	visitors    map[string]Presence
+}
+
+// Hub keeps the active visitors of every project in memory and pushes
+// hits, plus periodic stats, to the subscribers of each project.
+type Hub struct {
+	mutex    sync.Mutex
+	projects map[string]*project
+	closed   bool
+
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewHub(interval time.Duration) *Hub {
+	return &Hub{
+		projects: map[string]*project{},
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Subscription receives the messages of one project until it is closed or
+// the hub stops, at which point C is closed.
+type Subscription struct {
+	C <-chan Message
+
+	c         chan Message
+	hub       *Hub
+	projectID string
+}
+
+func (h *Hub) Start() {
+	go func() {
+		defer close(h.done)
+
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.tick()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the ticker and closes every subscription so open streams
+// return.
+func (h *Hub) Stop() {
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		return
+	}
+	h.closed = true
+	for _, p := range h.projects {
+		for sub := range p.subscribers {
+			close(sub.c)
+		}
+		p.subscribers = nil
+	}
+	h.mutex.Unlock()
+
+	close(h.stop)
+	<-h.done
+}
+
+func (h *Hub) project(projectID string) *project {
+	p := h.projects[projectID]
+	if p == nil {
+		p = &project{
+			subscribers: map[*Subscription]struct{}{},
+			visitors:    map[string]Presence{},
+		}
+		h.projects[projectID] = p
+	}
+	return p
+}
+
+// Subscribe registers a subscriber for a project. It returns nil once the
+// hub is stopped.
+func (h *Hub) Subscribe(projectID string) *Subscription {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	c := make(chan Message, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, hub: h, projectID: projectID}
+	h.project(projectID).subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (s *Subscription) Close() {
+	s.hub.mutex.Lock()
+	defer s.hub.mutex.Unlock()
+
+	p := s.hub.projects[s.projectID]
+	if p == nil {
+		return
+	}
+	if _, ok := p.subscribers[s]; ok {
+		delete(p.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Publish records the visitor as active and sends the hit to the project's
+// subscribers. Slow subscribers miss hits rather than block tracking.
+func (h *Hub) Publish(projectID string, hit Hit) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	p := h.project(projectID)
+	p.visitors[hit.VisitorID] = Presence{VisitorID: hit.VisitorID, Path: hit.Path, Seen: hit.CreatedAt}
+
+	msg := Message{Event: hit.Type, Data: hit}
+	for sub := range p.subscribers {
+		select {
+		case sub.c <- msg:
+		default:
+		}
+	}
+}
+
+// Seed fills in visitors seen before the hub started, such as those loaded
+// from the database when a dashboard connects. Newer in-memory entries win.
+func (h *Hub) Seed(projectID string, visitors []Presence) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	p := h.project(projectID)
+	for _, v := range visitors {
+		if current, ok := p.visitors[v.VisitorID]; !ok || current.Seen.Before(v.Seen) {
+			p.visitors[v.VisitorID] = v
+		}
+	}
+}
+
+// Stats returns the active visitors of a project and the pages they are on.
+func (h *Hub) Stats(projectID string) Stats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	p := h.projects[projectID]
+	if p == nil {
+		return Stats{Pages: []PageCount{}, AsOf: now}
+	}
+	return p.stats(now)
+}
+
+func (p *project) stats(now time.Time) Stats {
+	since := now.Add(-ActiveWindow)
+	counts := map[string]int{}
+	active := 0
+	for _, v := range p.visitors {
+		if v.Seen.Before(since) {
+			continue
+		}
+		active++
+		counts[v.Path]++
+	}
+
+	pages := make([]PageCount, 0, len(counts))
+	for path, n := range counts {
+		pages = append(pages, PageCount{Path: path, Visitors: n})
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Visitors != pages[j].Visitors {
+			return pages[i].Visitors > pages[j].Visitors
+		}
+		return pages[i].Path < pages[j].Path
+	})
+	if len(pages) > topPages {
+		pages = pages[:topPages]
+	}
+
+	return Stats{ActiveVisitors: active, Pages: pages, AsOf: now}
+}
+
+// tick drops inactive visitors and pushes fresh stats to every project that
+// has subscribers.
+func (h *Hub) tick() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	since := now.Add(-ActiveWindow)
+	for id, p := range h.projects {
+		for visitor, v := range p.visitors {
+			if v.Seen.Before(since) {
+				delete(p.visitors, visitor)
+			}
+		}
+		if len(p.subscribers) == 0 {
+			if len(p.visitors) == 0 {
+				delete(h.projects, id)
+			}
+			continue
+		}
+
+		msg := Message{Event: "stats", Data: p.stats(now)}
+		for sub := range p.subscribers {
+			select {
+			case sub.c <- msg:
+			default:
+			}
+		}
+	}
+}
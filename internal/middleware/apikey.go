@@ -14,7 +14,10 @@ import (
 	"jiramo/internal/utils"
 )
 
-func APIKey(db *gorm.DB) func(http.Handler) http.Handler {
+// APIKey authenticates a request with an API key of the project in the
+// route. db is called on every request, so that a database configured
+// through the setup wizard is picked up.
+func APIKey(db func() *gorm.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			rawKey := extractAPIKey(r)
@@ -30,7 +33,7 @@ func APIKey(db *gorm.DB) func(http.Handler) http.Handler {
 			}
 
 			var keys []models.APIKey
-			if err := db.Where("project_id = ?", projectID).Find(&keys).Error; err != nil {
+			if err := db().Where("project_id = ?", projectID).Find(&keys).Error; err != nil {
 				http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
 				return
 			}
@@ -66,7 +69,7 @@ func APIKey(db *gorm.DB) func(http.Handler) http.Handler {
 	}
 }
 
-func AuthOrAPIKey(db *gorm.DB) func(http.Handler) http.Handler {
+func AuthOrAPIKey(db func() *gorm.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		jwtMiddleware := Auth(next)
 		apiKeyMiddleware := APIKey(db)(next)
@@ -10,7 +10,7 @@ func AppState(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
-		if path == "/" || path == "/api/setup/status" {
+		if path == "/" || path == "/api/setup/status" || path == "/js/script.js" {
 			next.ServeHTTP(w, r)
 			return
 		}
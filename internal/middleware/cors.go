@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"jiramo/internal/models"
+	"jiramo/internal/utils"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxTrackingBody caps the body of a tracking request.
+const MaxTrackingBody = 64 << 10
+
+var errBodyTooLarge = errors.New("body too large")
+
+// AnalyticsCORS guards the public analytics endpoints. It answers CORS
+// preflights and only lets a request through when its Origin (or Referer,
+// for requests that carry no Origin) matches the AllowedOrigins of the
+// project named in the body or the project_id query parameter. The Origin
+// is only echoed back once it is allowed; preflights, which carry no body,
+// are answered for any Origin.
+//
+// db is called on every request, so that a database configured through the
+// setup wizard is picked up. Bodies larger than maxBody are refused.
+func AnalyticsCORS(db func() *gorm.DB, maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin != "" {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if r.Method == http.MethodOptions {
+				if origin != "" {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			projectID, err := trackingProjectID(r, maxBody)
+			if errors.Is(err, errBodyTooLarge) {
+				utils.WriteError(w, http.StatusRequestEntityTooLarge, "Payload too large")
+				return
+			}
+			if err != nil {
+				utils.WriteError(w, http.StatusBadRequest, "Invalid project_id")
+				return
+			}
+
+			var project models.Project
+			if err := db().Select("id", "allowed_origins").First(&project, "id = ?", projectID).Error; err != nil {
+				utils.WriteError(w, http.StatusNotFound, "Project not found")
+				return
+			}
+
+			if len(project.AllowedOrigins) > 0 && !utils.OriginAllowed(project.AllowedOrigins, requestOrigin(r)) {
+				utils.WriteError(w, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+			if origin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// trackingProjectID reads project_id from the query string or the JSON
+// body, restoring the body for the next handler.
+func trackingProjectID(r *http.Request, maxBody int64) (uuid.UUID, error) {
+	if id := r.URL.Query().Get("project_id"); id != "" {
+		return uuid.Parse(id)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if int64(len(body)) > maxBody {
+		return uuid.Nil, errBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var payload struct {
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(payload.ProjectID)
+}
+
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		return origin
+	}
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host != "" {
+		return ref.Scheme + "://" + ref.Host
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AlertMetric string
+
+const (
+	AlertVisitors AlertMetric = "visitors"
+	AlertViews    AlertMetric = "views"
+	AlertEvents   AlertMetric = "event"
+)
+
+type AlertCondition string
+
+const (
+	// AlertAbove and AlertBelow compare the metric with Threshold.
+	AlertAbove AlertCondition = "above"
+	AlertBelow AlertCondition = "below"
+	// AlertDrop and AlertSpike compare the metric with its average over the
+	// same window on each of the previous BaselineDays days; Threshold is
+	// the deviation in percent.
+	AlertDrop  AlertCondition = "drop"
+	AlertSpike AlertCondition = "spike"
+)
+
+// AlertRule watches a metric of a project over a rolling window and sends a
+// notification through Channel when its condition holds.
+type AlertRule struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID uuid.UUID      `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project   Project        `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Name      string         `json:"name" gorm:"not null"`
+	Metric    AlertMetric    `json:"metric" gorm:"type:varchar(16);not null"`
+	EventName string         `json:"event_name,omitempty"`
+	Condition AlertCondition `json:"condition" gorm:"type:varchar(16);not null"`
+	Threshold float64        `json:"threshold" gorm:"not null"`
+	// Window is the length of the rolling window in minutes.
+	Window       int `json:"window" gorm:"not null"`
+	BaselineDays int `json:"baseline_days" gorm:"not null;default:7"`
+	// Cooldown is the minimum number of minutes between two notifications.
+	Cooldown int `json:"cooldown" gorm:"not null;default:60"`
+
+	// Channel names a registered notifier; Target is its destination, such
+	// as a webhook URL or comma-separated email addresses.
+	Channel string `json:"channel" gorm:"type:varchar(32);not null"`
+	Target  string `json:"target"`
+
+	Enabled         bool       `json:"enabled" gorm:"not null;default:true"`
+	LastValue       *float64   `json:"last_value"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Notification is a message kept in the in-app notification store.
+type Notification struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID uuid.UUID  `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project   Project    `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	RuleID    *uuid.UUID `json:"rule_id" gorm:"type:uuid;index"`
+	Title     string     `json:"title" gorm:"not null"`
+	Body      string     `json:"body" gorm:"type:text"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
@@ -17,14 +17,19 @@ type Session struct {
 	OS          string    `json:"os"`
 	Device      string    `json:"device"`
 	Country     string    `json:"country"`
+	Region      string    `json:"region"`
+	City        string    `json:"city"`
 	Language    string    `json:"language"`
 	Referrer    string    `json:"referrer"`
 	UTMSource   string    `json:"utm_source"`
 	UTMMedium   string    `json:"utm_medium"`
 	UTMCampaign string    `json:"utm_campaign"`
+	Channel     string    `json:"channel" gorm:"size:16;index"`
 	CreatedAt   time.Time `json:"created_at" gorm:"index"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+	// ImportID is set on sessions brought in by an import.
+	ImportID *uuid.UUID `json:"import_id,omitempty" gorm:"type:uuid;index"`
 }
 
 type PageView struct {
@@ -39,17 +44,21 @@ type PageView struct {
 	Title     string    `json:"title"`
 	Duration  int       `json:"duration" gorm:"default:0"`
 	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	// ImportID is set on page views brought in by an import.
+	ImportID *uuid.UUID `json:"import_id,omitempty" gorm:"type:uuid;index"`
 }
 
 type AnalyticsEvent struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
-	ProjectID uuid.UUID `json:"project_id" gorm:"type:uuid;not null;index"`
-	Project   Project   `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
-	SessionID string    `json:"session_id" gorm:"not null;index"`
-	VisitorID string    `json:"visitor_id" gorm:"not null"`
-	URL       string    `json:"url" gorm:"not null"`
-	Path      string    `json:"path" gorm:"not null"`
-	EventName string    `json:"event_name" gorm:"not null;index"`
-	EventData string    `json:"event_data" gorm:"type:text"`
-	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID  uuid.UUID  `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project    Project    `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	SessionID  string     `json:"session_id" gorm:"not null;index"`
+	VisitorID  string     `json:"visitor_id" gorm:"not null"`
+	URL        string     `json:"url" gorm:"not null"`
+	Path       string     `json:"path" gorm:"not null"`
+	EventName  string     `json:"event_name" gorm:"not null;index"`
+	Properties Properties `json:"properties" gorm:"type:jsonb;not null;default:'{}'"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+	// ImportID is set on events brought in by an import.
+	ImportID *uuid.UUID `json:"import_id,omitempty" gorm:"type:uuid;index"`
 }
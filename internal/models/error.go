@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ErrorStatus string
+
+const (
+	ErrorUnresolved ErrorStatus = "unresolved"
+	ErrorResolved   ErrorStatus = "resolved"
+	ErrorIgnored    ErrorStatus = "ignored"
+)
+
+// ErrorGroup is an issue: the JavaScript errors of a project sharing a
+// fingerprint. A resolved group is reopened by its next occurrence.
+type ErrorGroup struct {
+	ID          uuid.UUID   `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID   uuid.UUID   `json:"project_id" gorm:"type:uuid;not null;uniqueIndex:idx_error_groups_fingerprint"`
+	Project     Project     `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Fingerprint string      `json:"fingerprint" gorm:"size:64;not null;uniqueIndex:idx_error_groups_fingerprint"`
+	Type        string      `json:"type" gorm:"not null"`
+	Message     string      `json:"message" gorm:"not null"`
+	Culprit     string      `json:"culprit"`
+	Status      ErrorStatus `json:"status" gorm:"type:varchar(16);not null;default:'unresolved';index"`
+	Count       int64       `json:"count" gorm:"not null;default:0"`
+	// Sessions is the number of distinct sessions the error occurred in.
+	Sessions    int64      `json:"sessions" gorm:"not null;default:0"`
+	LastRelease string     `json:"last_release"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at" gorm:"index"`
+	ResolvedAt  *time.Time `json:"resolved_at"`
+}
+
+// ErrorOccurrence is one reported error, linked to the session and page
+// view it happened in.
+type ErrorOccurrence struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID   uuid.UUID  `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project     Project    `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	GroupID     uuid.UUID  `json:"group_id" gorm:"type:uuid;not null;index"`
+	Group       ErrorGroup `json:"-" gorm:"foreignKey:GroupID;references:ID;constraint:OnDelete:CASCADE"`
+	Fingerprint string     `json:"-" gorm:"size:64;not null"`
+	SessionID   string     `json:"session_id" gorm:"not null;index"`
+	VisitorID   string     `json:"visitor_id" gorm:"not null"`
+	ViewID      *uuid.UUID `json:"view_id" gorm:"type:uuid"`
+	URL         string     `json:"url" gorm:"not null"`
+	Path        string     `json:"path" gorm:"not null"`
+	Message     string     `json:"message" gorm:"not null"`
+	Stack       string     `json:"stack" gorm:"type:text"`
+	Release     string     `json:"release"`
+	Browser     string     `json:"browser"`
+	OS          string     `json:"os"`
+	Device      string     `json:"device"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FilteredHit counts the tracking requests of a project rejected on one
+// UTC day for a given reason, such as a bot User-Agent or an excluded IP.
+type FilteredHit struct {
+	ProjectID uuid.UUID `json:"project_id" gorm:"type:uuid;primaryKey"`
+	Project   Project   `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Day       time.Time `json:"day" gorm:"type:date;primaryKey"`
+	Reason    string    `json:"reason" gorm:"size:32;primaryKey"`
+	Count     int64     `json:"count" gorm:"not null;default:0"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type GoalType string
+
+const (
+	GoalPage  GoalType = "page"
+	GoalEvent GoalType = "event"
+)
+
+type Goal struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID   uuid.UUID `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project     Project   `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Name        string    `json:"name" gorm:"not null"`
+	Type        GoalType  `json:"type" gorm:"type:varchar(10);not null;check:type IN ('page','event')"`
+	PathPattern string    `json:"path_pattern,omitempty"`
+	EventName   string    `json:"event_name,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Funnel struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID uuid.UUID `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project   Project   `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Name      string    `json:"name" gorm:"not null"`
+	// MaxStepInterval is the longest time in seconds allowed between two
+	// consecutive steps; zero means no limit.
+	MaxStepInterval int          `json:"max_step_interval" gorm:"not null;default:0"`
+	Steps           []FunnelStep `json:"steps" gorm:"foreignKey:FunnelID;constraint:OnDelete:CASCADE"`
+	CreatedAt       time.Time    `json:"created_at"`
+}
+
+type FunnelStep struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	FunnelID    uuid.UUID `json:"funnel_id" gorm:"type:uuid;not null;index"`
+	Position    int       `json:"position" gorm:"not null"`
+	Name        string    `json:"name"`
+	Type        GoalType  `json:"type" gorm:"type:varchar(10);not null;check:type IN ('page','event')"`
+	PathPattern string    `json:"path_pattern,omitempty"`
+	EventName   string    `json:"event_name,omitempty"`
+}
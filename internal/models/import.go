@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ImportSource string
+
+const (
+	ImportPlausible ImportSource = "plausible"
+	ImportUmami     ImportSource = "umami"
+	ImportGA4       ImportSource = "ga4"
+)
+
+type ImportStatus string
+
+const (
+	ImportPending    ImportStatus = "pending"
+	ImportRunning    ImportStatus = "running"
+	ImportCompleted  ImportStatus = "completed"
+	ImportFailed     ImportStatus = "failed"
+	ImportRolledBack ImportStatus = "rolled_back"
+)
+
+// Import brings the history of another analytics tool into a project from
+// an uploaded export. Every row it writes carries its ID so that it can be
+// rolled back.
+type Import struct {
+	ID        uuid.UUID    `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID uuid.UUID    `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project   Project      `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Source    ImportSource `json:"source" gorm:"type:varchar(16);not null"`
+	FileName  string       `json:"file_name"`
+	// FileHash is the SHA-256 of the uploaded file; a file is imported
+	// once per project.
+	FileHash string `json:"file_hash" gorm:"type:varchar(64);not null;index"`
+	// FilePath is where the upload waits for the job, removed once done.
+	FilePath string `json:"-"`
+	// WebsiteID picks one website of an Umami export that holds several.
+	WebsiteID string       `json:"website_id,omitempty"`
+	Status    ImportStatus `json:"status" gorm:"type:varchar(16);not null;index"`
+	// Progress is the share of the file processed, from 0 to 100.
+	Progress int `json:"progress" gorm:"not null;default:0"`
+
+	Sessions  int64 `json:"sessions" gorm:"not null;default:0"`
+	PageViews int64 `json:"page_views" gorm:"not null;default:0"`
+	Events    int64 `json:"events" gorm:"not null;default:0"`
+	// Days counts the days brought in; Skipped counts the days, or hits of
+	// those days, left out because the project already has data for them.
+	Days      int64      `json:"days" gorm:"not null;default:0"`
+	Skipped   int64      `json:"skipped" gorm:"not null;default:0"`
+	FirstDay  *time.Time `json:"first_day"`
+	LastDay   *time.Time `json:"last_day"`
+	Error     string     `json:"error,omitempty"`
+	CreatedBy uuid.UUID  `json:"created_by" gorm:"type:uuid"`
+
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -13,6 +13,22 @@ type Project struct {
 	CustomerID uuid.UUID `json:"customer_id" gorm:"type:uuid;not null;index"`
 	Customer   User      `gorm:"foreignKey:CustomerID;references:ID"`
 	Status     bool      `json:"status" gorm:"not null;default:0"`
+
+	// AllowedOrigins lists the sites allowed to send analytics for the
+	// project, as full origins, bare hostnames or *.example.com wildcards.
+	// An empty list accepts any origin.
+	AllowedOrigins StringList `json:"allowed_origins" gorm:"type:jsonb;not null;default:'[]'"`
+
+	// RetentionDays is how long raw analytics are kept; zero uses the
+	// global default.
+	RetentionDays int `json:"retention_days" gorm:"not null;default:0"`
+
+	// RespectDNT skips tracking for browsers sending DNT or Sec-GPC.
+	RespectDNT bool `json:"respect_dnt" gorm:"not null;default:false"`
+
+	// ExcludedIPs lists addresses and CIDR ranges whose hits are counted as
+	// filtered instead of tracked, e.g. the team's office network.
+	ExcludedIPs StringList `json:"excluded_ips" gorm:"type:jsonb;not null;default:'[]'"`
 }
 
 func (u *Project) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReportFrequency string
+
+const (
+	ReportDaily   ReportFrequency = "daily"
+	ReportWeekly  ReportFrequency = "weekly"
+	ReportMonthly ReportFrequency = "monthly"
+)
+
+// ReportSubscription emails a summary of a project's analytics to its
+// recipients after every day, week or month, as seen in Timezone.
+type ReportSubscription struct {
+	ID         uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID  uuid.UUID       `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project    Project         `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Recipients StringList      `json:"recipients" gorm:"type:jsonb;not null;default:'[]'"`
+	Frequency  ReportFrequency `json:"frequency" gorm:"type:varchar(10);not null"`
+	// Timezone is an IANA zone name; periods start at local midnight.
+	Timezone string `json:"timezone" gorm:"not null;default:'UTC'"`
+	Enabled  bool   `json:"enabled" gorm:"not null;default:true"`
+
+	NextRunAt  time.Time  `json:"next_run_at" gorm:"not null;index"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	// LastError is the reason the last delivery failed, empty after a
+	// successful one.
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PruneRun records the raw analytics rows removed from a project by one run
+// of the retention job.
+type PruneRun struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID uuid.UUID `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project   Project   `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Cutoff    time.Time `json:"cutoff"`
+	PageViews int64     `json:"page_views"`
+	Events    int64     `json:"events"`
+	WebVitals int64     `json:"web_vitals"`
+	Errors    int64     `json:"errors"`
+	Sessions  int64     `json:"sessions"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
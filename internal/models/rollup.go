@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RollupGranularity string
+
+const (
+	RollupHour RollupGranularity = "hour"
+	RollupDay  RollupGranularity = "day"
+)
+
+// Rollup holds the pre-aggregated traffic of a project for one UTC hour or
+// day. Sessions and bounces are attributed to the bucket the session
+// started in; Duration is the sum of page view durations in seconds.
+// Rollups of imported days carry the ImportID of the import.
+type Rollup struct {
+	ProjectID   uuid.UUID         `json:"project_id" gorm:"type:uuid;primaryKey"`
+	Project     Project           `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Granularity RollupGranularity `json:"granularity" gorm:"type:varchar(5);primaryKey"`
+	Bucket      time.Time         `json:"bucket" gorm:"primaryKey"`
+	Views       int64             `json:"views" gorm:"not null;default:0"`
+	Visitors    int64             `json:"visitors" gorm:"not null;default:0"`
+	Sessions    int64             `json:"sessions" gorm:"not null;default:0"`
+	Bounces     int64             `json:"bounces" gorm:"not null;default:0"`
+	Duration    int64             `json:"duration" gorm:"not null;default:0"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	ImportID    *uuid.UUID        `json:"import_id,omitempty" gorm:"type:uuid;index"`
+}
+
+// DimensionRollup holds the daily top values of a breakdown dimension.
+// Rows of imported days carry the ImportID of the import and are left alone
+// by the rollup job.
+type DimensionRollup struct {
+	ProjectID uuid.UUID  `json:"project_id" gorm:"type:uuid;primaryKey"`
+	Project   Project    `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Bucket    time.Time  `json:"bucket" gorm:"primaryKey"`
+	Dimension string     `json:"dimension" gorm:"type:varchar(32);primaryKey"`
+	Value     string     `json:"value" gorm:"primaryKey"`
+	Views     int64      `json:"views" gorm:"not null;default:0"`
+	Visitors  int64      `json:"visitors" gorm:"not null;default:0"`
+	Sessions  int64      `json:"sessions" gorm:"not null;default:0"`
+	Bounces   int64      `json:"bounces" gorm:"not null;default:0"`
+	Duration  int64      `json:"duration" gorm:"not null;default:0"`
+	ImportID  *uuid.UUID `json:"import_id,omitempty" gorm:"type:uuid;index"`
+}
+
+// RollupState records how far the rollup job has aggregated raw data.
+// Every bucket ending at or before Watermark is final.
+type RollupState struct {
+	Name      string    `gorm:"primaryKey"`
+	Watermark time.Time `gorm:"not null"`
+}
+
+// RollupRewind marks a project whose rollups since Since are stale, because
+// hits dated before the watermark were stored. The rollup job aggregates
+// those days again and removes the mark unless MarkedAt moved meanwhile.
+type RollupRewind struct {
+	ProjectID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Project   Project   `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	Since     time.Time `gorm:"not null"`
+	MarkedAt  time.Time `gorm:"not null"`
+}
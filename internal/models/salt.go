@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Salt is the secret mixed into visitor fingerprints for one UTC day. Only
+// the current and previous day's salts are kept, so fingerprints cannot be
+// linked across days once a salt is discarded.
+type Salt struct {
+	Day       time.Time `gorm:"type:date;primaryKey"`
+	Value     string    `gorm:"not null"`
+	CreatedAt time.Time
+}
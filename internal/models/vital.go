@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebVital is one Core Web Vitals measurement of a page view. Device is
+// copied from the session so reports per device need no join.
+type WebVital struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	ProjectID uuid.UUID  `json:"project_id" gorm:"type:uuid;not null;index"`
+	Project   Project    `json:"-" gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE"`
+	SessionID string     `json:"session_id" gorm:"not null;index"`
+	ViewID    *uuid.UUID `json:"view_id" gorm:"type:uuid"`
+	Path      string     `json:"path" gorm:"not null"`
+	Device    string     `json:"device"`
+	Name      string     `json:"name" gorm:"type:varchar(8);not null"`
+	Value     float64    `json:"value" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
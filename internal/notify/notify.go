@@ -0,0 +1,104 @@
+// Package notify delivers alert and report messages through pluggable
+// channels. A channel is any Notifier registered under a name; rules refer
+// to channels by that name.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// Message is what every channel delivers. Data carries extra values for
+// machine-readable channels such as webhooks.
+type Message struct {
+	ProjectID uuid.UUID              `json:"project_id"`
+	RuleID    *uuid.UUID             `json:"rule_id,omitempty"`
+	Title     string                 `json:"title"`
+	Body      string                 `json:"body"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// Notifier sends a message to target, whose meaning depends on the
+// channel: a URL, a list of addresses, or nothing at all.
+type Notifier interface {
+	Notify(ctx context.Context, target string, msg Message) error
+}
+
+// TargetValidator is implemented by notifiers that can reject a target
+// when a rule is saved rather than when it fires.
+type TargetValidator interface {
+	ValidateTarget(target string) error
+}
+
+type Registry struct {
+	mutex     sync.RWMutex
+	notifiers map[string]Notifier
+}
+
+func NewRegistry() *Registry {
+	return &Registry{notifiers: map[string]Notifier{}}
+}
+
+// Register adds or replaces the notifier of a channel.
+func (r *Registry) Register(channel string, n Notifier) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.notifiers[channel] = n
+}
+
+// Channels lists the registered channel names.
+func (r *Registry) Channels() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.notifiers))
+	for name := range r.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) notifier(channel string) (Notifier, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	n, ok := r.notifiers[channel]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownChannel, channel)
+	}
+	return n, nil
+}
+
+// ValidateTarget checks that channel exists and, when its notifier
+// supports it, that target is usable.
+func (r *Registry) ValidateTarget(channel, target string) error {
+	n, err := r.notifier(channel)
+	if err != nil {
+		return err
+	}
+	if v, ok := n.(TargetValidator); ok {
+		return v.ValidateTarget(target)
+	}
+	return nil
+}
+
+func (r *Registry) Send(ctx context.Context, channel, target string, msg Message) error {
+	n, err := r.notifier(channel)
+	if err != nil {
+		return err
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	return n.Notify(ctx, target, msg)
+}
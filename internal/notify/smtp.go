@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP sends messages by email. The target is a comma-separated list of
+// recipients.
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) ValidateTarget(target string) error {
+	_, err := parseRecipients(target)
+	return err
+}
+
+func (s *SMTP) Notify(ctx context.Context, target string, msg Message) error {
+	to, err := parseRecipients(target)
+	if err != nil {
+		return err
+	}
+	return s.Send(ctx, to, msg.Title, "text/plain", msg.Body)
+}
+
+// smtpTimeout bounds a delivery when ctx has no deadline of its own.
+const smtpTimeout = time.Minute
+
+// Send delivers one email with the given content type, e.g. text/html.
+// Authentication is only attempted when a username is configured; net/smtp
+// refuses PLAIN auth without TLS except on localhost.
+func (s *SMTP) Send(ctx context.Context, to []string, subject, contentType, body string) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP sender: %w", err)
+	}
+
+	var buf bytes.Buffer
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: " + contentType + "; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	for _, h := range headers {
+		buf.WriteString(h + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	err = s.sendMail(ctx, auth, from.Address, to, buf.Bytes())
+	if err != nil && ctx.Err() != nil {
+		// Closing the connection on cancellation hides why it was closed.
+		return fmt.Errorf("smtp: %w", ctx.Err())
+	}
+	return err
+}
+
+// sendMail is smtp.SendMail with a connection that honours ctx: the dial
+// and every later exchange with the server stop at its deadline or when it
+// is cancelled.
+func (s *SMTP) sendMail(ctx context.Context, auth smtp.Auth, from string, to []string, msg []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, s.Port))
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func parseRecipients(target string) ([]string, error) {
+	list, err := mail.ParseAddressList(target)
+	if err != nil || len(list) == 0 {
+		return nil, errors.New("email target must be a comma-separated list of addresses")
+	}
+	to := make([]string, len(list))
+	for i, addr := range list {
+		to[i] = addr.Address
+	}
+	return to, nil
+}
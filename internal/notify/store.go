@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"jiramo/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Store keeps messages as in-app notifications of the project; the target
+// is ignored.
+type Store struct {
+	db func() *gorm.DB
+}
+
+func NewStore(db func() *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) Notify(ctx context.Context, target string, msg Message) error {
+	db := s.db()
+	if db == nil {
+		return errors.New("database not configured")
+	}
+	return db.WithContext(ctx).Create(&models.Notification{
+		ID:        uuid.New(),
+		ProjectID: msg.ProjectID,
+		RuleID:    msg.RuleID,
+		Title:     msg.Title,
+		Body:      msg.Body,
+		CreatedAt: msg.CreatedAt,
+	}).Error
+}
@@ -0,0 +1,103 @@
+package reports
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"time"
+
+	"jiramo/internal/models"
+)
+
+//go:embed report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"number":  formatNumber,
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", v) },
+}).Parse(reportHTML))
+
+type metric struct {
+	Label  string
+	Value  string
+	Change string
+	Up     bool
+}
+
+// Subject is the email subject of a report.
+func (r *Report) Subject() string {
+	kind := "Daily"
+	switch r.Frequency {
+	case models.ReportWeekly:
+		kind = "Weekly"
+	case models.ReportMonthly:
+		kind = "Monthly"
+	}
+	return fmt.Sprintf("%s report for %s: %s", kind, r.Project.Title, r.period())
+}
+
+func (r *Report) period() string {
+	switch r.Frequency {
+	case models.ReportMonthly:
+		return r.From.Format("January 2006")
+	case models.ReportWeekly:
+		return r.From.Format("Jan 2") + " – " + r.To.Format("Jan 2, 2006")
+	default:
+		return r.From.Format("Monday, Jan 2, 2006")
+	}
+}
+
+// Render returns the report as an HTML document.
+func (r *Report) Render() (string, error) {
+	metrics := []metric{
+		newMetric("Visitors", float64(r.Totals.Visitors), float64(r.Previous.Visitors), formatNumber(r.Totals.Visitors), false),
+		newMetric("Visits", float64(r.Totals.Sessions), float64(r.Previous.Sessions), formatNumber(r.Totals.Sessions), false),
+		newMetric("Page views", float64(r.Totals.Views), float64(r.Previous.Views), formatNumber(r.Totals.Views), false),
+		newMetric("Bounce rate", r.Totals.BounceRate(), r.Previous.BounceRate(), fmt.Sprintf("%.0f%%", r.Totals.BounceRate()), true),
+		newMetric("Visit duration", r.Totals.AvgDuration(), r.Previous.AvgDuration(), formatDuration(r.Totals.AvgDuration()), false),
+	}
+
+	var buf bytes.Buffer
+	err := reportTemplate.Execute(&buf, map[string]interface{}{
+		"Subject": r.Subject(),
+		"Period":  r.period(),
+		"Report":  r,
+		"Metrics": metrics,
+	})
+	return buf.String(), err
+}
+
+// newMetric describes the change from previous to current. For metrics
+// where lower is better, such as the bounce rate, a decrease shows as good.
+func newMetric(label string, current, previous float64, value string, lowerIsBetter bool) metric {
+	m := metric{Label: label, Value: value}
+	if previous == 0 {
+		return m
+	}
+	change := (current - previous) / previous * 100
+	m.Change = fmt.Sprintf("%+.0f%%", change)
+	m.Up = (change >= 0) != lowerIsBetter
+	return m
+}
+
+func formatNumber(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if n < 0 {
+		return "-" + formatNumber(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+func formatDuration(seconds float64) string {
+	d := time.Duration(math.Round(seconds)) * time.Second
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm %02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,123 @@
+package reports
+
+import (
+	"time"
+
+	"jiramo/internal/analytics"
+	"jiramo/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const topLimit = 10
+
+// Row is an entry of a top list. Count is the number of page views for
+// pages and of visits for sources.
+type Row struct {
+	Value    string
+	Visitors int64
+	Count    int64
+}
+
+// Report is the content of one report email.
+type Report struct {
+	Project   models.Project
+	Frequency models.ReportFrequency
+	From      time.Time
+	To        time.Time
+
+	Totals   analytics.Totals
+	Previous analytics.Totals
+
+	TopPages   []Row
+	TopSources []Row
+	Goals      []analytics.GoalConversion
+}
+
+// Build gathers the report of a project for [from, to], with the totals of
+// the period of the same length just before it for comparison.
+func Build(db *gorm.DB, project models.Project, frequency models.ReportFrequency, from, to time.Time) (*Report, error) {
+	report := &Report{Project: project, Frequency: frequency, From: from, To: to}
+	projectID := project.ID.String()
+
+	var err error
+	if report.Totals, err = analytics.ProjectTotals(db, projectID, from, to); err != nil {
+		return nil, err
+	}
+	span := to.Sub(from) + time.Second
+	if report.Previous, err = analytics.ProjectTotals(db, projectID, from.Add(-span), to.Add(-span)); err != nil {
+		return nil, err
+	}
+
+	pages, _, err := analytics.Breakdown(db, projectID, from, to, analytics.BreakdownQuery{Dimension: "page", Limit: topLimit})
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		report.TopPages = append(report.TopPages, Row{Value: page.Value, Visitors: page.Visitors, Count: page.Views})
+	}
+
+	sources, _, err := analytics.Breakdown(db, projectID, from, to, analytics.BreakdownQuery{Dimension: "referrer", Limit: topLimit})
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		report.TopSources = append(report.TopSources, Row{Value: source.Value, Visitors: source.Visitors, Count: source.Sessions})
+	}
+
+	var goals []models.Goal
+	if err := db.Where("project_id = ?", project.ID).Order("created_at").Find(&goals).Error; err != nil {
+		return nil, err
+	}
+	if report.Goals, err = analytics.GoalConversions(db, project.ID, goals, from, to); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Period returns the period a report sent at run covers: the day, week or
+// month that ended at the last local midnight.
+func Period(frequency models.ReportFrequency, loc *time.Location, run time.Time) (from, to time.Time) {
+	t := run.In(loc)
+	end := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch frequency {
+	case models.ReportWeekly:
+		from = end.AddDate(0, 0, -7)
+	case models.ReportMonthly:
+		from = end.AddDate(0, -1, 0)
+	default:
+		from = end.AddDate(0, 0, -1)
+	}
+	return from, end.Add(-time.Second)
+}
+
+// sendHour is the local hour at which reports go out.
+const sendHour = 8
+
+// NextRun returns the first send time after the given instant: every day,
+// on Mondays or on the first of the month, at sendHour local time.
+func NextRun(frequency models.ReportFrequency, loc *time.Location, after time.Time) time.Time {
+	t := after.In(loc)
+	y, m, d := t.Date()
+	switch frequency {
+	case models.ReportWeekly:
+		next := time.Date(y, m, d+(8-int(t.Weekday()))%7, sendHour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	case models.ReportMonthly:
+		next := time.Date(y, m, 1, sendHour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 1, 0)
+		}
+		return next
+	default:
+		next := time.Date(y, m, d, sendHour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
@@ -0,0 +1,132 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"jiramo/internal/models"
+	"jiramo/internal/notify"
+
+	"gorm.io/gorm"
+)
+
+// sendTimeout bounds the delivery of one report.
+const sendTimeout = time.Minute
+
+// Scheduler sends the report subscriptions that are due. Without a mailer
+// it does nothing, and due reports go out once SMTP is configured.
+type Scheduler struct {
+	db       func() *gorm.DB
+	mailer   *notify.SMTP
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewScheduler(db func() *gorm.DB, mailer *notify.SMTP, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		mailer:   mailer,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) Start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Run(); err != nil {
+				log.Printf("reports: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// Run sends every due subscription once. A failed delivery is recorded on
+// the subscription and not retried before its next run, so a bad address
+// does not produce an email on every tick.
+func (s *Scheduler) Run() error {
+	db := s.db()
+	if db == nil || s.mailer == nil {
+		return nil
+	}
+
+	now := time.Now()
+	var subs []models.ReportSubscription
+	err := db.Preload("Project").
+		Where("enabled = ? AND next_run_at <= ?", true, now).
+		Find(&subs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		updates := map[string]interface{}{"last_error": ""}
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := Send(ctx, db, s.mailer, sub, sub.NextRunAt)
+		cancel()
+		if err != nil {
+			log.Printf("reports: subscription %s: %v", sub.ID, err)
+			updates["last_error"] = err.Error()
+		} else {
+			updates["last_sent_at"] = now
+		}
+
+		loc, err := time.LoadLocation(sub.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		updates["next_run_at"] = NextRun(sub.Frequency, loc, now)
+
+		if err := db.Model(&models.ReportSubscription{}).Where("id = ?", sub.ID).Updates(updates).Error; err != nil {
+			log.Printf("reports: subscription %s: %v", sub.ID, err)
+		}
+	}
+	return nil
+}
+
+// Send builds the report a subscription receives at run and emails it to
+// its recipients. The subscription's Project must be loaded.
+func Send(ctx context.Context, db *gorm.DB, mailer *notify.SMTP, sub models.ReportSubscription, run time.Time) error {
+	if len(sub.Recipients) == 0 {
+		return errors.New("no recipients")
+	}
+	report, err := ForSubscription(db, sub, run)
+	if err != nil {
+		return err
+	}
+	body, err := report.Render()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, sub.Recipients, report.Subject(), "text/html", body)
+}
+
+// ForSubscription builds the report a subscription receives at run.
+func ForSubscription(db *gorm.DB, sub models.ReportSubscription, run time.Time) (*Report, error) {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", sub.Timezone)
+	}
+	from, to := Period(sub.Frequency, loc, run)
+	return Build(db, sub.Project, sub.Frequency, from, to)
+}
@@ -11,11 +11,16 @@ import (
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(router *mux.Router, authHandlers *handler.AuthHandler, projectHandlers *handler.ProjectHandler, webHandler *handler.WebHandler, userHandlers *handler.UserHandler, setupHandler *handler.SetupHandler, profileHandler *handler.ProfileHandler, analyticsHandler *handler.AnalyticsHandler, apiKeyHandler *handler.APIKeyHandler, db *gorm.DB) {
+func SetupRoutes(router *mux.Router, authHandlers *handler.AuthHandler, projectHandlers *handler.ProjectHandler, webHandler *handler.WebHandler, userHandlers *handler.UserHandler, setupHandler *handler.SetupHandler, profileHandler *handler.ProfileHandler, analyticsHandler *handler.AnalyticsHandler, apiKeyHandler *handler.APIKeyHandler, goalHandler *handler.GoalHandler, alertHandler *handler.AlertHandler, reportHandler *handler.ReportHandler, importHandler *handler.ImportHandler) {
+	// The middlewares look the database up on every request, since the setup
+	// wizard may configure it after startup.
+	currentDB := func() *gorm.DB { return analyticsHandler.DB }
+
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSON(w, http.StatusOK, "Hello from jiramo API")
 	})
 	router.Handle("/", webHandler.UIHandler())
+	router.Handle("/js/script.js", webHandler.TrackerHandler()).Methods("GET", "HEAD")
 
 	// /api subrouter
 	apiRouter := router.PathPrefix("/api").Subrouter()
@@ -65,7 +70,7 @@ func SetupRoutes(router *mux.Router, authHandlers *handler.AuthHandler, projectH
 
 	// projects - private
 	statusRouter := apiRouter.PathPrefix("/projects/{id}").Subrouter()
-	statusRouter.Use(middleware.AuthOrAPIKey(db))
+	statusRouter.Use(middleware.AuthOrAPIKey(currentDB))
 	statusRouter.HandleFunc("/status", projectHandlers.GetProjectStatus).Methods("GET")
 	statusRouter.HandleFunc("/status/set", projectHandlers.SetProjectStatus).Methods("POST")
 	statusRouter.HandleFunc("/status/toggle", projectHandlers.ToggleProjectStatus).Methods("PATCH")
@@ -79,9 +84,25 @@ func SetupRoutes(router *mux.Router, authHandlers *handler.AuthHandler, projectH
 	apiKeyRouter.HandleFunc("/{keyId}", apiKeyHandler.Delete).Methods("DELETE")
 
 	// analytics - public
+	// The pixel skips AnalyticsCORS: emails and AMP caches send no usable
+	// Origin, so it checks the Referer itself when there is one.
+	apiRouter.HandleFunc("/analytics/pixel.gif", analyticsHandler.Pixel).Methods("GET")
+
+	// Batches are larger than single hits, so they get a limit of their own.
+	apiRouter.Handle("/analytics/batch", middleware.AnalyticsCORS(currentDB, handler.MaxBatchBody)(http.HandlerFunc(analyticsHandler.TrackBatch))).Methods("POST", "OPTIONS")
+
 	analyticsRouter := apiRouter.PathPrefix("/analytics").Subrouter()
-	analyticsRouter.HandleFunc("/track", analyticsHandler.Track).Methods("POST")
-	analyticsRouter.HandleFunc("/event", analyticsHandler.TrackEvent).Methods("POST")
+	analyticsRouter.Use(middleware.AnalyticsCORS(currentDB, middleware.MaxTrackingBody))
+	analyticsRouter.HandleFunc("/track", analyticsHandler.Track).Methods("POST", "OPTIONS")
+	analyticsRouter.HandleFunc("/event", analyticsHandler.TrackEvent).Methods("POST", "OPTIONS")
+	analyticsRouter.HandleFunc("/leave", analyticsHandler.Leave).Methods("POST", "OPTIONS")
+	analyticsRouter.HandleFunc("/vitals", analyticsHandler.TrackVitals).Methods("POST", "OPTIONS")
+	analyticsRouter.HandleFunc("/error", analyticsHandler.TrackError).Methods("POST", "OPTIONS")
+
+	// analytics - server side
+	serverEventRouter := apiRouter.PathPrefix("/projects/{id}/events").Subrouter()
+	serverEventRouter.Use(middleware.APIKey(currentDB))
+	serverEventRouter.HandleFunc("", analyticsHandler.TrackServerEvent).Methods("POST")
 
 	// analytics - private
 	analyticsPrivateRouter := apiRouter.PathPrefix("/projects/{id}/analytics").Subrouter()
@@ -89,6 +110,67 @@ func SetupRoutes(router *mux.Router, authHandlers *handler.AuthHandler, projectH
 	analyticsPrivateRouter.Use(middleware.RequireRole(models.RoleUser, models.RoleAdmin))
 	analyticsPrivateRouter.HandleFunc("", analyticsHandler.GetProjectStats).Methods("GET")
 	analyticsPrivateRouter.HandleFunc("/realtime", analyticsHandler.GetRealtimeStats).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/live", analyticsHandler.GetLive).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/timeseries", analyticsHandler.GetTimeseries).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/breakdown/{dimension}", analyticsHandler.GetBreakdown).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/pruning", analyticsHandler.GetPruneRuns).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/filtered", analyticsHandler.GetFilteredHits).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/events/{name}", analyticsHandler.GetEventBreakdown).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/events/{name}/properties", analyticsHandler.GetEventPropertyKeys).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/entry-pages", analyticsHandler.GetEntryPages).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/exit-pages", analyticsHandler.GetExitPages).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/vitals", analyticsHandler.GetVitals).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/vitals/{dimension}", analyticsHandler.GetVitalsBreakdown).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/errors", analyticsHandler.GetErrors).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/errors/{errorId}", analyticsHandler.GetError).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/errors/{errorId}", analyticsHandler.UpdateError).Methods("PATCH")
+	analyticsPrivateRouter.HandleFunc("/sessions", analyticsHandler.GetSessions).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/sessions/{sessionId}", analyticsHandler.GetSessionTimeline).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/goals", analyticsHandler.GetGoalConversions).Methods("GET")
+	analyticsPrivateRouter.HandleFunc("/funnels/{funnelId}", analyticsHandler.GetFunnelReport).Methods("GET")
+
+	// goals and funnels - private
+	goalRouter := apiRouter.PathPrefix("/projects/{id}").Subrouter()
+	goalRouter.Use(middleware.Auth)
+	goalRouter.Use(middleware.RequireRole(models.RoleUser, models.RoleAdmin))
+	goalRouter.HandleFunc("/goals", goalHandler.ListGoals).Methods("GET")
+	goalRouter.HandleFunc("/goals", goalHandler.CreateGoal).Methods("POST")
+	goalRouter.HandleFunc("/goals/{goalId}", goalHandler.DeleteGoal).Methods("DELETE")
+	goalRouter.HandleFunc("/funnels", goalHandler.ListFunnels).Methods("GET")
+	goalRouter.HandleFunc("/funnels", goalHandler.CreateFunnel).Methods("POST")
+	goalRouter.HandleFunc("/funnels/{funnelId}", goalHandler.DeleteFunnel).Methods("DELETE")
+
+	// alerts and notifications - private
+	alertRouter := apiRouter.PathPrefix("/projects/{id}").Subrouter()
+	alertRouter.Use(middleware.Auth)
+	alertRouter.Use(middleware.RequireRole(models.RoleUser, models.RoleAdmin))
+	alertRouter.HandleFunc("/alerts", alertHandler.ListAlertRules).Methods("GET")
+	alertRouter.HandleFunc("/alerts", alertHandler.CreateAlertRule).Methods("POST")
+	alertRouter.HandleFunc("/alerts/{alertId}", alertHandler.UpdateAlertRule).Methods("PATCH")
+	alertRouter.HandleFunc("/alerts/{alertId}", alertHandler.DeleteAlertRule).Methods("DELETE")
+	alertRouter.HandleFunc("/alerts/{alertId}/test", alertHandler.TestAlertRule).Methods("POST")
+	alertRouter.HandleFunc("/notifications", alertHandler.ListNotifications).Methods("GET")
+	alertRouter.HandleFunc("/notifications/{notificationId}/read", alertHandler.MarkNotificationRead).Methods("POST")
+
+	// report subscriptions - private
+	reportRouter := apiRouter.PathPrefix("/projects/{id}/reports").Subrouter()
+	reportRouter.Use(middleware.Auth)
+	reportRouter.Use(middleware.RequireRole(models.RoleUser, models.RoleAdmin))
+	reportRouter.HandleFunc("", reportHandler.ListReportSubscriptions).Methods("GET")
+	reportRouter.HandleFunc("", reportHandler.CreateReportSubscription).Methods("POST")
+	reportRouter.HandleFunc("/{reportId}", reportHandler.UpdateReportSubscription).Methods("PATCH")
+	reportRouter.HandleFunc("/{reportId}", reportHandler.DeleteReportSubscription).Methods("DELETE")
+	reportRouter.HandleFunc("/{reportId}/preview", reportHandler.PreviewReport).Methods("GET")
+	reportRouter.HandleFunc("/{reportId}/send", reportHandler.SendReport).Methods("POST")
+
+	// history imports - private
+	importRouter := apiRouter.PathPrefix("/projects/{id}/imports").Subrouter()
+	importRouter.Use(middleware.Auth)
+	importRouter.Use(middleware.RequireRole(models.RoleUser, models.RoleAdmin))
+	importRouter.HandleFunc("", importHandler.ListImports).Methods("GET")
+	importRouter.HandleFunc("", importHandler.CreateImport).Methods("POST")
+	importRouter.HandleFunc("/{importId}", importHandler.GetImport).Methods("GET")
+	importRouter.HandleFunc("/{importId}", importHandler.RollbackImport).Methods("DELETE")
 
 	// ERRORS
 	// 404
@@ -1,21 +1,32 @@
 package utils
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
 const SessionTTL = 30 * time.Minute
 
-func VisitorFingerprint(r *http.Request, projectID string) string {
-	ip := realIP(r)
-	userAgent := r.UserAgent()
+// VisitorFingerprint derives an anonymous visitor ID from the IP address,
+// User-Agent and project, keyed with a daily salt so the ID changes every
+// day and cannot be reversed to the IP without the salt.
+func VisitorFingerprint(ip, userAgent, projectID string, salt []byte) string {
 	raw := ip + "|" + userAgent + "|" + projectID
-	sum := sha256.Sum256([]byte(raw))
-	return fmt.Sprintf("%x", sum)
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(raw))
+	return fmt.Sprintf("%x", mac.Sum(nil))
+}
+
+// DoNotTrack reports whether the browser sent a DNT or Global Privacy
+// Control opt-out signal.
+func DoNotTrack(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
 }
 
 func NewSessionID(visitorID string) string {
@@ -75,7 +86,9 @@ func ParseUserAgent(ua string) (browser, os, device string) {
 	return
 }
 
-func realIP(r *http.Request) string {
+// ClientIP returns the client address, preferring the headers set by a
+// reverse proxy over the connection's remote address.
+func ClientIP(r *http.Request) string {
 	if ip := r.Header.Get("X-Real-Ip"); ip != "" {
 		return strings.TrimSpace(ip)
 	}
@@ -85,15 +98,37 @@ func realIP(r *http.Request) string {
 		return strings.TrimSpace(parts[0])
 	}
 
-	addr := r.RemoteAddr
-	if index := strings.LastIndex(addr, ":"); index != -1 {
-		return addr[:index]
+	// SplitHostPort also drops the brackets around IPv6 addresses.
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
 	}
-	return addr
+	return r.RemoteAddr
 }
 
-func ParseUTM(r *http.Request) (source, medium, campaign string) {
-	return r.URL.Query().Get("utm_source"),
-		r.URL.Query().Get("utm_medium"),
-		r.URL.Query().Get("utm_campaign")
+// ParseUTM reads the campaign parameters of a landing page URL. The ref
+// parameter stands in for a missing utm_source, and Google and Facebook
+// click IDs attribute untagged ad clicks to their network.
+func ParseUTM(u *url.URL) (source, medium, campaign string) {
+	query := u.Query()
+	source = query.Get("utm_source")
+	medium = query.Get("utm_medium")
+	campaign = query.Get("utm_campaign")
+
+	if source == "" {
+		source = query.Get("ref")
+	}
+	switch {
+	case query.Get("gclid") != "":
+		if source == "" {
+			source = "google"
+		}
+		if medium == "" {
+			medium = "cpc"
+		}
+	case query.Get("fbclid") != "":
+		if source == "" {
+			source = "facebook"
+		}
+	}
+	return source, medium, campaign
 }
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	BotUserAgent      = "bot_user_agent"
+	BotEmptyUserAgent = "empty_user_agent"
+	BotHeadless       = "headless"
+	BotNoLanguage     = "no_accept_language"
+	BotExcludedIP     = "excluded_ip"
+)
+
+//go:embed bots.txt
+var defaultBotPatterns []byte
+
+var (
+	botPatternsMutex sync.RWMutex
+	botPatterns      = parseBotPatterns(defaultBotPatterns)
+)
+
+var headlessMarkers = []string{"headless", "phantomjs", "slimerjs", "htmlunit", "lighthouse"}
+
+// LoadBotPatterns replaces the embedded bot list with the patterns in path,
+// one lowercase User-Agent substring per line.
+func LoadBotPatterns(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	patterns := parseBotPatterns(data)
+	botPatternsMutex.Lock()
+	botPatterns = patterns
+	botPatternsMutex.Unlock()
+	return nil
+}
+
+func parseBotPatterns(data []byte) []string {
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// DetectBot returns why a request looks automated, or "" for a browser.
+func DetectBot(r *http.Request) string {
+	ua := strings.ToLower(r.UserAgent())
+	if strings.TrimSpace(ua) == "" {
+		return BotEmptyUserAgent
+	}
+
+	for _, marker := range headlessMarkers {
+		if strings.Contains(ua, marker) {
+			return BotHeadless
+		}
+	}
+
+	botPatternsMutex.RLock()
+	patterns := botPatterns
+	botPatternsMutex.RUnlock()
+	for _, pattern := range patterns {
+		if strings.Contains(ua, pattern) {
+			return BotUserAgent
+		}
+	}
+	return ""
+}
+
+// DetectTrackerBot is DetectBot for requests sent by the tracker script.
+// Browsers always send Accept-Language, so its absence gives away scripted
+// clients there; apps, email image proxies and server-side callers often
+// leave it out.
+func DetectTrackerBot(r *http.Request) string {
+	if reason := DetectBot(r); reason != "" {
+		return reason
+	}
+	if r.Header.Get("Accept-Language") == "" {
+		return BotNoLanguage
+	}
+	return ""
+}
+
+// IPExcluded reports whether the client IP matches one of the entries,
+// which may be single addresses or CIDR ranges.
+func IPExcluded(r *http.Request, entries []string) bool {
+	return AddrExcluded(ClientIP(r), entries)
+}
+
+// AddrExcluded is IPExcluded for an address known outside of a request.
+func AddrExcluded(addr string, entries []string) bool {
+	if len(entries) == 0 {
+		return false
+	}
+
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil && addr.Unmap() == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidIPOrCIDR reports whether entry is an IP address or a CIDR range.
+func ValidIPOrCIDR(entry string) bool {
+	if _, err := netip.ParsePrefix(entry); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(entry)
+	return err == nil
+}
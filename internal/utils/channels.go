@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"net/url"
+	"strings"
+)
+
+const (
+	ChannelDirect   = "direct"
+	ChannelSearch   = "search"
+	ChannelSocial   = "social"
+	ChannelEmail    = "email"
+	ChannelPaid     = "paid"
+	ChannelReferral = "referral"
+)
+
+//go:embed sources.txt
+var sourceList []byte
+
+var sourceChannels = parseSourceChannels(sourceList)
+
+var paidMediums = map[string]bool{
+	"cpc": true, "ppc": true, "cpm": true, "cpa": true, "paid": true,
+	"paidsearch": true, "paid_search": true, "paid-search": true,
+	"paidsocial": true, "paid_social": true, "paid-social": true,
+	"display": true, "banner": true, "retargeting": true, "affiliate": true,
+}
+
+var mediumChannels = map[string]string{
+	"email":          ChannelEmail,
+	"e-mail":         ChannelEmail,
+	"newsletter":     ChannelEmail,
+	"social":         ChannelSocial,
+	"social-network": ChannelSocial,
+	"social_network": ChannelSocial,
+	"organic":        ChannelSearch,
+	"referral":       ChannelReferral,
+}
+
+type sourcePattern struct {
+	channel string
+	pattern string
+}
+
+func parseSourceChannels(data []byte) []sourcePattern {
+	var patterns []sourcePattern
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(strings.ToLower(scanner.Text()))
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		patterns = append(patterns, sourcePattern{channel: fields[0], pattern: fields[1]})
+	}
+	return patterns
+}
+
+// ClassifyChannel assigns a session to a marketing channel from its
+// referrer and campaign parameters. hostname is the tracked site, so that
+// internal navigation counts as direct traffic.
+func ClassifyChannel(referrer, hostname, source, medium string) string {
+	source = strings.ToLower(strings.TrimSpace(source))
+	medium = strings.ToLower(strings.TrimSpace(medium))
+
+	if paidMediums[medium] {
+		return ChannelPaid
+	}
+	if channel, ok := mediumChannels[medium]; ok {
+		return channel
+	}
+	if source != "" {
+		if channel := matchSource(source); channel != "" {
+			return channel
+		}
+	}
+
+	refHost := ""
+	if u, err := url.Parse(referrer); err == nil {
+		refHost = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	}
+	if refHost == "" || refHost == strings.TrimPrefix(strings.ToLower(hostname), "www.") {
+		if source != "" {
+			return ChannelReferral
+		}
+		return ChannelDirect
+	}
+	if channel := matchSource(refHost); channel != "" {
+		return channel
+	}
+	return ChannelReferral
+}
+
+// matchSource looks up host in the source list. Domain patterns are tried
+// before label patterns so that mail.google.com is email, not search.
+func matchSource(host string) string {
+	for _, p := range sourceChannels {
+		if strings.Contains(p.pattern, ".") && (host == p.pattern || strings.HasSuffix(host, "."+p.pattern)) {
+			return p.channel
+		}
+	}
+
+	labels := strings.Split(host, ".")
+	for _, p := range sourceChannels {
+		if strings.Contains(p.pattern, ".") {
+			continue
+		}
+		for _, label := range labels {
+			if label == p.pattern {
+				return p.channel
+			}
+		}
+	}
+	return ""
+}
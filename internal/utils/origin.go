@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// OriginAllowed reports whether origin (e.g. "https://www.example.com")
+// matches one of the allowed entries. Entries may be full origins, bare
+// hostnames, or "*.example.com" to accept the domain and its subdomains.
+// An empty list allows every origin.
+func OriginAllowed(allowed []string, origin string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimRight(strings.TrimSpace(entry), "/"))
+		switch {
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "://"):
+			if entry == scheme+"://"+host {
+				return true
+			}
+		case strings.HasPrefix(entry, "*."):
+			if hostname == entry[2:] || strings.HasSuffix(hostname, entry[1:]) {
+				return true
+			}
+		case entry == host || entry == hostname:
+			return true
+		}
+	}
+	return false
+}
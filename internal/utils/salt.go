@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"jiramo/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaltRotator hands out the daily visitor salts, creating today's salt on
+// first use and deleting salts older than yesterday. Salts live in the
+// database so every instance derives the same visitor IDs.
+type SaltRotator struct {
+	mutex    sync.Mutex
+	db       func() *gorm.DB
+	day      time.Time
+	current  []byte
+	previous []byte
+}
+
+func NewSaltRotator(db func() *gorm.DB) *SaltRotator {
+	return &SaltRotator{db: db}
+}
+
+// Salts returns today's salt and, when it still exists, yesterday's, which
+// lets sessions continue across midnight.
+func (s *SaltRotator) Salts() (current, previous []byte, err error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.current != nil && s.day.Equal(today) {
+		return s.current, s.previous, nil
+	}
+
+	db := s.db()
+	if db == nil {
+		return nil, nil, gorm.ErrInvalidDB
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+
+	salt := models.Salt{Day: today, Value: hex.EncodeToString(secret), CreatedAt: time.Now()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&salt).Error; err != nil {
+		return nil, nil, err
+	}
+
+	yesterday := today.AddDate(0, 0, -1)
+	if err := db.Where("day < ?", yesterday).Delete(&models.Salt{}).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var salts []models.Salt
+	if err := db.Where("day >= ?", yesterday).Order("day DESC").Find(&salts).Error; err != nil {
+		return nil, nil, err
+	}
+
+	s.current, s.previous = nil, nil
+	for _, salt := range salts {
+		value, err := hex.DecodeString(salt.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if salt.Day.UTC().Equal(today) {
+			s.current = value
+		} else {
+			s.previous = value
+		}
+	}
+	if s.current == nil {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+
+	s.day = today
+	return s.current, s.previous, nil
+}
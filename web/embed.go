@@ -8,6 +8,14 @@ import (
 //go:embed dist/**
 var distFS embed.FS
 
+//go:embed tracker/script.js
+var trackerJS []byte
+
 func Dist() (fs.FS, error) {
 	return fs.Sub(distFS, "dist")
 }
+
+// Tracker returns the client-side tracking script served at /js/script.js.
+func Tracker() []byte {
+	return trackerJS
+}
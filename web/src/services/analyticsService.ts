@@ -11,6 +11,7 @@ export interface ProjectStats {
     event_name: string;
     count: number;
   }>;
+  note?: string;
 }
 
 export interface RealtimeStats {
@@ -23,6 +24,7 @@ export interface TrackPayload {
   url: string;
   referrer?: string;
   title?: string;
+  prev_view_id?: string;
   prev_path?: string;
   prev_created_at?: string;
 }
@@ -0,0 +1,290 @@
+/*
+ * jiramo tracker
+ *
+ * <script defer data-project-id="PROJECT_UUID" src="https://jiramo.example.com/js/script.js"></script>
+ *
+ * Optional attributes:
+ *   data-api             base URL of the jiramo API (defaults to the script origin)
+ *   data-outbound-links  "false" disables outbound link click events
+ *   data-file-downloads  "false" disables file download events
+ *   data-web-vitals      "false" disables Core Web Vitals reporting
+ *   data-errors          "false" disables JavaScript error reporting
+ *   data-release         version of the site, attached to reported errors
+ */
+(function () {
+  'use strict';
+
+  var script = document.currentScript;
+  if (!script) return;
+
+  var projectId = script.getAttribute('data-project-id');
+  if (!projectId) return;
+
+  var api = (script.getAttribute('data-api') || new URL(script.src).origin).replace(/\/$/, '');
+  var trackOutbound = script.getAttribute('data-outbound-links') !== 'false';
+  var trackDownloads = script.getAttribute('data-file-downloads') !== 'false';
+  var trackVitals = script.getAttribute('data-web-vitals') !== 'false';
+  var trackErrors = script.getAttribute('data-errors') !== 'false';
+  var release = script.getAttribute('data-release') || '';
+
+  var downloadExtensions = [
+    'pdf', 'xlsx', 'xls', 'docx', 'doc', 'pptx', 'ppt', 'csv', 'txt', 'rtf',
+    'zip', 'rar', '7z', 'gz', 'tar', 'dmg', 'exe', 'msi', 'pkg', 'deb', 'apk',
+    'mp3', 'wav', 'mp4', 'mov', 'avi', 'mkv'
+  ];
+
+  var current = null; // { path, viewId }
+  var landing = null; // the view of the page load, which vitals belong to
+
+  // text/plain keeps requests "simple" so browsers skip the CORS preflight.
+  function send(path, payload, beacon) {
+    var body = JSON.stringify(payload);
+    var url = api + path;
+
+    if (beacon && navigator.sendBeacon) {
+      navigator.sendBeacon(url, new Blob([body], { type: 'text/plain' }));
+      return Promise.resolve(null);
+    }
+
+    return fetch(url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'text/plain' },
+      body: body,
+      keepalive: true
+    }).then(function (res) {
+      return res.ok ? res.json() : null;
+    }).catch(function () {
+      return null;
+    });
+  }
+
+  function pageview() {
+    var path = location.pathname;
+    if (current && current.path === path) return;
+
+    var payload = {
+      project_id: projectId,
+      url: location.href,
+      referrer: current ? '' : document.referrer,
+      title: document.title
+    };
+    if (current && current.viewId) {
+      payload.prev_view_id = current.viewId;
+    }
+
+    var view = { path: path, viewId: null };
+    current = view;
+    if (!landing) landing = view;
+
+    send('/api/analytics/track', payload).then(function (res) {
+      if (res && res.view_id) view.viewId = res.view_id;
+    });
+  }
+
+  function leave() {
+    if (!current || !current.viewId) return;
+    send('/api/analytics/leave', {
+      project_id: projectId,
+      view_id: current.viewId
+    }, true);
+  }
+
+  function track(name, data) {
+    if (!name) return;
+    send('/api/analytics/event', {
+      project_id: projectId,
+      url: location.href,
+      event_name: String(name),
+      props: data || {}
+    }, true);
+  }
+
+  // Core Web Vitals of the page load. They describe the document, not SPA
+  // navigations, and are sent once, the first time the page is hidden.
+  // INP is approximated by the slowest interaction.
+  var vitals = {};
+  var vitalsSent = false;
+
+  function observe(type, callback, options) {
+    try {
+      var po = new PerformanceObserver(function (list) {
+        list.getEntries().forEach(callback);
+      });
+      options = options || {};
+      options.type = type;
+      options.buffered = true;
+      po.observe(options);
+    } catch (err) {
+      // Entry type not supported by this browser.
+    }
+  }
+
+  function collectVitals() {
+    if (!window.PerformanceObserver) return;
+
+    var nav = performance.getEntriesByType && performance.getEntriesByType('navigation')[0];
+    if (nav && nav.responseStart > 0) {
+      vitals.TTFB = Math.max(nav.responseStart - (nav.activationStart || 0), 0);
+    }
+
+    observe('paint', function (entry) {
+      if (entry.name === 'first-contentful-paint') {
+        vitals.FCP = Math.max(entry.startTime - (nav && nav.activationStart || 0), 0);
+      }
+    });
+
+    observe('largest-contentful-paint', function (entry) {
+      vitals.LCP = Math.max(entry.startTime - (nav && nav.activationStart || 0), 0);
+    });
+
+    var windowValue = 0, windowStart = 0, windowLast = 0;
+    observe('layout-shift', function (entry) {
+      if (entry.hadRecentInput) return;
+      // Shifts less than 1s apart and within 5s form one session window;
+      // CLS is the largest window.
+      if (windowValue && entry.startTime - windowLast < 1000 && entry.startTime - windowStart < 5000) {
+        windowValue += entry.value;
+      } else {
+        windowValue = entry.value;
+        windowStart = entry.startTime;
+      }
+      windowLast = entry.startTime;
+      vitals.CLS = Math.max(vitals.CLS || 0, windowValue);
+    });
+
+    observe('event', function (entry) {
+      if (entry.interactionId) {
+        vitals.INP = Math.max(vitals.INP || 0, entry.duration);
+      }
+    }, { durationThreshold: 40 });
+    observe('first-input', function (entry) {
+      vitals.INP = Math.max(vitals.INP || 0, entry.duration);
+    });
+  }
+
+  function sendVitals() {
+    if (vitalsSent || !landing || !landing.viewId) return;
+    var metrics = {};
+    var any = false;
+    for (var name in vitals) {
+      metrics[name] = name === 'CLS' ? Math.round(vitals[name] * 10000) / 10000 : Math.round(vitals[name]);
+      any = true;
+    }
+    if (!any) return;
+    vitalsSent = true;
+    send('/api/analytics/vitals', {
+      project_id: projectId,
+      view_id: landing.viewId,
+      url: location.protocol + '//' + location.host + landing.path,
+      metrics: metrics
+    }, true);
+  }
+
+  // Uncaught errors and unhandled rejections. Each distinct error is sent
+  // once per page load, and at most maxErrors in total, so an error thrown
+  // in a loop does not flood the API.
+  var maxErrors = 10;
+  var reportedErrors = {};
+  var errorCount = 0;
+
+  function reportError(message, stack) {
+    message = String(message || '');
+    stack = String(stack || '');
+    // Cross-origin scripts without CORS only expose "Script error.".
+    if (!message || (message === 'Script error.' && !stack)) return;
+
+    var key = message + '\n' + stack;
+    if (reportedErrors[key] || errorCount >= maxErrors) return;
+    reportedErrors[key] = true;
+    errorCount++;
+
+    send('/api/analytics/error', {
+      project_id: projectId,
+      view_id: current && current.viewId ? current.viewId : '',
+      url: location.href,
+      message: message,
+      stack: stack,
+      release: release
+    }, true);
+  }
+
+  function onError(e) {
+    var err = e.error;
+    var stack = err && err.stack;
+    if (!stack && e.filename) {
+      stack = '    at ' + e.filename + ':' + e.lineno + ':' + e.colno;
+    }
+    var message = err && err.name && err.message ? err.name + ': ' + err.message : e.message;
+    reportError(message, stack);
+  }
+
+  function onRejection(e) {
+    var reason = e.reason;
+    if (reason instanceof Error) {
+      reportError(reason.name + ': ' + reason.message, reason.stack);
+    } else {
+      reportError('Unhandled rejection: ' + (typeof reason === 'string' ? reason : JSON.stringify(reason)), '');
+    }
+  }
+
+  function onClick(e) {
+    var link = e.target && e.target.closest ? e.target.closest('a[href]') : null;
+    if (!link) return;
+
+    var url;
+    try {
+      url = new URL(link.href, location.href);
+    } catch (err) {
+      return;
+    }
+    if (url.protocol !== 'http:' && url.protocol !== 'https:') return;
+
+    var ext = url.pathname.split('.').pop().toLowerCase();
+    if (trackDownloads && url.pathname.indexOf('.') !== -1 && downloadExtensions.indexOf(ext) !== -1) {
+      track('File Download', { url: url.href });
+    } else if (trackOutbound && url.host !== location.host) {
+      track('Outbound Link: Click', { url: url.href });
+    }
+  }
+
+  var pushState = history.pushState;
+  history.pushState = function () {
+    pushState.apply(this, arguments);
+    pageview();
+  };
+  var replaceState = history.replaceState;
+  history.replaceState = function () {
+    replaceState.apply(this, arguments);
+    pageview();
+  };
+  window.addEventListener('popstate', pageview);
+
+  document.addEventListener('visibilitychange', function () {
+    if (document.visibilityState === 'hidden') {
+      if (trackVitals) sendVitals();
+      leave();
+    }
+  });
+  window.addEventListener('pagehide', function () {
+    if (trackVitals) sendVitals();
+    leave();
+  });
+
+  if (trackOutbound || trackDownloads) {
+    document.addEventListener('click', onClick, true);
+    document.addEventListener('auxclick', onClick, true);
+  }
+
+  var queued = (window.jiramo && window.jiramo.q) || [];
+  window.jiramo = { track: track };
+  for (var i = 0; i < queued.length; i++) {
+    track.apply(null, queued[i]);
+  }
+
+  if (trackVitals) collectVitals();
+  if (trackErrors) {
+    window.addEventListener('error', onError);
+    window.addEventListener('unhandledrejection', onRejection);
+  }
+  pageview();
+})();